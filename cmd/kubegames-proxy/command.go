@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	"github.com/kubegames/kubegames-proxy/pkg/proxy"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+//annotation authoring commands
+var commands = map[string]func(args []string, out io.Writer) error{
+	"encode":  encode,
+	"decode":  decode,
+	"lint":    lint,
+	"explain": explain,
+}
+
+//run command of args, exit code
+func command(args []string) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %s, commands: encode decode lint explain\n", args[0])
+		return 2
+	}
+
+	//output of commands is stdout, logs of the table go to stderr
+	log.SetOut(os.Stderr)
+	if err := cmd(args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], err.Error())
+		return 1
+	}
+	return 0
+}
+
+//encode yaml or json rules to the legacy proxy annotation
+func encode(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("encode", flag.ContinueOnError)
+	v2 := fs.Bool("v2", false, "print compact json for the "+proxy.AnnotationProxyV2+" annotation")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: kubegames-proxy encode [-v2] [file]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := input(fs.Args())
+	if err != nil {
+		return err
+	}
+	rules, err := route.Parse(data)
+	if err != nil {
+		return err
+	}
+	if *v2 {
+		buff, err := yaml.YAMLToJSON(data)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\n", buff)
+		return nil
+	}
+	value, err := route.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s\n", value)
+	return nil
+}
+
+//decode the legacy proxy annotation to yaml
+func decode(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("decode", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: kubegames-proxy decode [file | annotation]\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var data []byte
+	if fs.NArg() == 1 && isBase64(fs.Arg(0)) {
+		data = []byte(fs.Arg(0))
+	} else {
+		d, err := input(fs.Args())
+		if err != nil {
+			return err
+		}
+		data = d
+	}
+	rules, err := route.Unmarshal(strings.TrimSpace(string(data)))
+	if err != nil {
+		return err
+	}
+	buff, err := yaml.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(buff)
+	return err
+}
+
+//check rules of an annotation value or of the annotations of a pod or
+//service manifest against the validation of the proxy
+func lint(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: kubegames-proxy lint [file]\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := input(fs.Args())
+	if err != nil {
+		return err
+	}
+	obj, err := manifest(data)
+	if err != nil {
+		return err
+	}
+
+	var rules *route.Rules
+	if obj != nil {
+		r, ok, err := proxy.AnnotationRules(obj.Annotations)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s %s has no proxy annotation", obj.Kind, obj.Name)
+		}
+		rules = r
+	} else {
+		r, err := annotationRules(data)
+		if err != nil {
+			return err
+		}
+		rules = r
+	}
+
+	//legacy annotations are checked strictly too, the proxy only
+	//rejects the rules its table can not route
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	if obj != nil && string(rules.ProxyPattern) != obj.Kind {
+		return fmt.Errorf("proxy pattern %s is ignored on a %s", rules.ProxyPattern, obj.Kind)
+	}
+	fmt.Fprintf(out, "ok, %d rules\n", len(rules.Items))
+	return nil
+}
+
+//show the routes of a pod or service manifest and the requests captured
+func explain(args []string, out io.Writer) error {
+	var requests, headers stringList
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	fs.Var(&requests, "r", "request to check (\"GET http://games.example.com/api/room/1\"), repeatable")
+	fs.Var(&headers, "H", "header of the requests (\"x-version: 2\" or \"Cookie: roomId=1\"), repeatable")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: kubegames-proxy explain [-r request]... [-H header]... [file]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := input(fs.Args())
+	if err != nil {
+		return err
+	}
+	obj, err := manifest(data)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return fmt.Errorf("explain needs a pod or service manifest")
+	}
+
+	rules, ok, err := proxy.AnnotationRules(obj.Annotations)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s %s has no proxy annotation", obj.Kind, obj.Name)
+	}
+	if string(rules.ProxyPattern) != obj.Kind {
+		return fmt.Errorf("proxy pattern %s is ignored on a %s", rules.ProxyPattern, obj.Kind)
+	}
+
+	//registrations as the proxy makes them
+	owner := route.NewOwner(obj.Namespace, obj.Kind, obj.Name, string(obj.UID))
+	var registrations []*route.Registration
+	fmt.Fprintf(out, "%s %s/%s %s\n", obj.Kind, obj.Namespace, obj.Name, obj.ip)
+	for _, rule := range rules.Items {
+		port, err := obj.port(rule)
+		if err != nil {
+			fmt.Fprintf(out, "  %s: %s\n", rule.AgentUrl, err.Error())
+			continue
+		}
+		proxyIp := fmt.Sprintf("http://%s:%d", obj.ip, port)
+		registrations = append(registrations, route.NewRegistration(rule, proxyIp, obj.Labels))
+		fmt.Fprintf(out, "  %s\n", describe(rule, proxyIp))
+	}
+
+	//requests, a pod not running and ready captures none
+	table := route.NewRoute()
+	if !obj.routed {
+		fmt.Fprintf(out, "  not routed, the pod is not running and ready\n")
+		registrations = nil
+	}
+	if err := table.Replace(owner, registrations); err != nil {
+		return err
+	}
+	for _, request := range requests {
+		req, err := newRequest(request, headers)
+		if err != nil {
+			return err
+		}
+		result, ok := table.Lookup(req)
+		switch {
+		case ok:
+			path := result.Path
+			if len(result.RawQuery) > 0 {
+				path += "?" + result.RawQuery
+			}
+			fmt.Fprintf(out, "%s ===> %s%s\n", request, result.Backend.ProxyIp, path)
+		case len(table.Allow(req)) > 0:
+			fmt.Fprintf(out, "%s ===> 405, allow %v\n", request, table.Allow(req))
+		default:
+			fmt.Fprintf(out, "%s ===> not captured\n", request)
+		}
+	}
+	return nil
+}
+
+//description of rule
+func describe(rule *route.Rule, proxyIp string) string {
+	methods := rule.Methods
+	if len(methods) <= 0 {
+		methods = []route.Method{rule.Method}
+	}
+	names := make([]string, len(methods))
+	for index, method := range methods {
+		names[index] = string(method)
+	}
+
+	host := rule.Host
+	if len(host) <= 0 {
+		host = "*"
+	}
+	match := rule.Match
+	if len(match) <= 0 {
+		match = route.Prefix
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s%s (%s) ===> %s", strings.Join(names, ","), host, rule.AgentUrl, match, proxyIp)
+	if rule.Rewrite != nil {
+		buff, _ := json.Marshal(rule.Rewrite)
+		fmt.Fprintf(&b, " rewrite %s", buff)
+	} else {
+		b.WriteString(rule.ProxyUrl)
+	}
+
+	//conditions
+	for _, c := range rule.Headers {
+		fmt.Fprintf(&b, "\n      header %s", c)
+	}
+	for _, c := range rule.Cookies {
+		fmt.Fprintf(&b, "\n      cookie %s", c)
+	}
+	for _, c := range rule.Query {
+		fmt.Fprintf(&b, "\n      query %s", c)
+	}
+	if len(rule.Balance) > 0 {
+		fmt.Fprintf(&b, "\n      balance %s", rule.Balance)
+	}
+	return b.String()
+}
+
+//pod or service of manifest
+type object struct {
+	metaV1.ObjectMeta
+	Kind   string
+	ip     string
+	routed bool
+	port   func(rule *route.Rule) (int32, error)
+}
+
+//object of a pod or service manifest, nil when data is not a manifest
+func manifest(data []byte) (*object, error) {
+	meta := new(metaV1.TypeMeta)
+	if err := yaml.Unmarshal(data, meta); err != nil || len(meta.Kind) <= 0 {
+		return nil, nil
+	}
+
+	switch meta.Kind {
+	case "Pod":
+		pod := new(v1.Pod)
+		if err := yaml.Unmarshal(data, pod); err != nil {
+			return nil, err
+		}
+		ip := pod.Status.PodIP
+		if len(ip) <= 0 {
+			ip = "<pod-ip>"
+		}
+		return &object{
+			ObjectMeta: pod.ObjectMeta,
+			Kind:       meta.Kind,
+			ip:         ip,
+			routed:     len(pod.Status.Phase) <= 0 || proxy.PodRouted(pod, drainGrace),
+			port: func(rule *route.Rule) (int32, error) {
+				return proxy.PodPort(pod, rule.Port)
+			},
+		}, nil
+	case "Service":
+		service := new(v1.Service)
+		if err := yaml.Unmarshal(data, service); err != nil {
+			return nil, err
+		}
+		ip := service.Spec.ClusterIP
+		if len(ip) <= 0 {
+			ip = "<cluster-ip>"
+		}
+		return &object{
+			ObjectMeta: service.ObjectMeta,
+			Kind:       meta.Kind,
+			ip:         ip,
+			routed:     true,
+			port: func(rule *route.Rule) (int32, error) {
+				return proxy.ServicePort(service, rule.Port)
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("kind %s has no proxy annotation, use a Pod or Service", meta.Kind)
+}
+
+//rules of an annotation value, the legacy base64 json or plain json or yaml
+func annotationRules(data []byte) (*route.Rules, error) {
+	value := strings.TrimSpace(string(data))
+	if isBase64(value) {
+		return route.Unmarshal(value)
+	}
+	return route.Parse(data)
+}
+
+//value is base64 json
+func isBase64(value string) bool {
+	buff, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	return err == nil && bytes.HasPrefix(bytes.TrimSpace(buff), []byte("{"))
+}
+
+//request of "METHOD url" with "name: value" headers
+func newRequest(request string, headers []string) (*http.Request, error) {
+	fields := strings.Fields(request)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("request %q should be \"METHOD url\"", request)
+	}
+	u, err := url.Parse(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	req := &http.Request{
+		Method: strings.ToUpper(fields[0]),
+		Host:   u.Host,
+		URL:    u,
+		Header: make(http.Header),
+	}
+	for _, header := range headers {
+		index := strings.Index(header, ":")
+		if index <= 0 {
+			return nil, fmt.Errorf("header %q should be \"name: value\"", header)
+		}
+		req.Header.Add(strings.TrimSpace(header[:index]), strings.TrimSpace(header[index+1:]))
+	}
+	return req, nil
+}
+
+//file of args or stdin
+func input(args []string) ([]byte, error) {
+	if len(args) <= 0 || args[0] == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(args[0])
+}
+
+//repeatable string flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
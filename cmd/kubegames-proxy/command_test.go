@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+)
+
+//file of data in a temporary directory
+func tempFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{
+			name:  "yaml",
+			rules: "ProxyPattern: Pod\nItems:\n- Methods: [GET, POST]\n  AgentUrl: /api/room/:roomId\n  ProxyUrl: /room/{roomId}\n  Port: 8080\n",
+		},
+		{
+			name:  "json with named port",
+			rules: `{"ProxyPattern": "Service", "Items": [{"Method": "GET", "AgentUrl": "/api/game", "ProxyUrl": "/game", "Port": "http-game"}]}`,
+		},
+		{
+			name:  "conditions and rewrite",
+			rules: "ProxyPattern: Pod\nItems:\n- Method: GET\n  AgentUrl: /api/game\n  Host: games.example.com\n  Headers:\n  - Name: x-version\n    Op: \"=\"\n    Value: \"2\"\n  Rewrite:\n    StripPrefix: /api\n  Port: 8080\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected, err := route.Parse([]byte(test.rules))
+			if err != nil {
+				t.Fatal(err)
+			}
+			file := tempFile(t, "rules.yaml", test.rules)
+
+			//legacy annotation decodes to the same rules
+			var encoded bytes.Buffer
+			if err := encode([]string{file}, &encoded); err != nil {
+				t.Fatal(err)
+			}
+			var decoded bytes.Buffer
+			if err := decode([]string{strings.TrimSpace(encoded.String())}, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			rules, err := route.Parse(decoded.Bytes())
+			if err != nil {
+				t.Fatalf("decoded %s err %s", decoded.String(), err.Error())
+			}
+			if !reflect.DeepEqual(rules, expected) {
+				t.Fatalf("decoded %s", decoded.String())
+			}
+
+			//compact json of the v2 annotation
+			var v2 bytes.Buffer
+			if err := encode([]string{"-v2", file}, &v2); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Count(strings.TrimSpace(v2.String()), "\n") != 0 {
+				t.Fatalf("v2 %s is not compact", v2.String())
+			}
+			rules, err = route.Parse(v2.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rules, expected) {
+				t.Fatalf("v2 %s", v2.String())
+			}
+		})
+	}
+
+	//invalid rules are not encoded
+	var out bytes.Buffer
+	if err := encode([]string{tempFile(t, "rules.yaml", "ProxyPattern: Pod\nItems:\n- Method: GET\n  AgentUrl: /api\n  Port: 0\n")}, &out); err == nil {
+		t.Fatalf("invalid rules encoded %s", out.String())
+	}
+	if err := decode([]string{"bm90IGpzb24="}, &out); err == nil {
+		t.Fatal("base64 without json should not decode")
+	}
+}
+
+func TestLint(t *testing.T) {
+	pod := func(annotations string) string {
+		return "apiVersion: v1\nkind: Pod\nmetadata:\n  name: game-0\n" + annotations
+	}
+	tests := []struct {
+		name string
+		data string
+		out  string
+		err  string
+	}{
+		{
+			name: "annotation",
+			data: "ProxyPattern: Pod\nItems:\n- Method: GET\n  AgentUrl: /api/game\n  ProxyUrl: /game\n  Port: 8080\n",
+			out:  "ok, 1 rules",
+		},
+		{
+			name: "legacy annotation",
+			data: "eyJQcm94eVBhdHRlcm4iOiJQb2QiLCJJdGVtcyI6W3siTWV0aG9kIjoiR0VUIiwiQWdlbnRVcmwiOiIvYXBpL2dhbWUiLCJQcm94eVVybCI6Ii9nYW1lIiwiUG9ydCI6ODA4MH1dfQ==",
+			out:  "ok, 1 rules",
+		},
+		{
+			name: "unknown field",
+			data: "ProxyPattern: Pod\nItems:\n- Method: GET\n  AgentUrl: /api/game\n  Timeout: 5s\n  Port: 8080\n",
+			err:  `unknown field "Timeout"`,
+		},
+		{
+			name: "port out of range",
+			data: "ProxyPattern: Pod\nItems:\n- Method: GET\n  AgentUrl: /api/game\n  ProxyUrl: /game\n  Port: 70000\n",
+			err:  "port 70000 out of range",
+		},
+		{
+			name: "relative agent url",
+			data: "ProxyPattern: Pod\nItems:\n- Method: GET\n  AgentUrl: api/game\n  ProxyUrl: /game\n  Port: 8080\n",
+			err:  "should start with /",
+		},
+		{
+			name: "unknown method",
+			data: "ProxyPattern: Pod\nItems:\n- Method: FETCH\n  AgentUrl: /api/game\n  ProxyUrl: /game\n  Port: 8080\n",
+			err:  `unknown method "FETCH"`,
+		},
+		{
+			name: "pod manifest",
+			data: pod("  annotations:\n    kubegames.io/proxy.v2: '{\"ProxyPattern\": \"Pod\", \"Items\": [{\"Method\": \"GET\", \"AgentUrl\": \"/api/game\", \"ProxyUrl\": \"/game\", \"Port\": \"http\"}]}'\n"),
+			out:  "ok, 1 rules",
+		},
+		{
+			name: "pod manifest without annotation",
+			data: pod(""),
+			err:  "Pod game-0 has no proxy annotation",
+		},
+		{
+			name: "pattern of another kind",
+			data: pod("  annotations:\n    kubegames.io/proxy.v2: '{\"ProxyPattern\": \"Service\", \"Items\": [{\"Method\": \"GET\", \"AgentUrl\": \"/api/game\", \"ProxyUrl\": \"/game\", \"Port\": 80}]}'\n"),
+			err:  "proxy pattern Service is ignored on a Pod",
+		},
+		{
+			name: "invalid v2 annotation",
+			data: pod("  annotations:\n    kubegames.io/proxy.v2: 'Items: ['\n"),
+			err:  "kubegames.io/proxy.v2",
+		},
+		{
+			name: "other kind",
+			data: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: game\n",
+			err:  "kind Deployment has no proxy annotation",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := lint([]string{tempFile(t, "annotation", test.data)}, &out)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(out.String()) != test.out {
+				t.Fatalf("output %s", out.String())
+			}
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	pod := func(status string) string {
+		return "apiVersion: v1\nkind: Pod\nmetadata:\n  namespace: default\n  name: game-0\n  annotations:\n    kubegames.io/proxy.v2: '{\"ProxyPattern\": \"Pod\", \"Items\": [{\"Method\": \"GET\", \"AgentUrl\": \"/api/game\", \"ProxyUrl\": \"/game\", \"Port\": 8080}]}'\n" + status
+	}
+	tests := []struct {
+		name   string
+		data   string
+		routed bool
+	}{
+		{
+			name:   "manifest without status",
+			data:   pod(""),
+			routed: true,
+		},
+		{
+			name:   "running and ready",
+			data:   pod("status:\n  phase: Running\n  podIP: 10.0.0.1\n  conditions:\n  - type: Ready\n    status: \"True\"\n"),
+			routed: true,
+		},
+		{
+			name: "running and not ready",
+			data: pod("status:\n  phase: Running\n  podIP: 10.0.0.1\n  conditions:\n  - type: Ready\n    status: \"False\"\n"),
+		},
+		{
+			name: "pending",
+			data: pod("status:\n  phase: Pending\n"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := explain([]string{"-r", "GET http://games.example.com/api/game", tempFile(t, "pod.yaml", test.data)}, &out); err != nil {
+				t.Fatal(err)
+			}
+			notRouted := strings.Contains(out.String(), "not routed")
+			notCaptured := strings.Contains(out.String(), "===> not captured")
+			if notRouted == test.routed || notCaptured == test.routed {
+				t.Fatalf("output %s", out.String())
+			}
+		})
+	}
+}
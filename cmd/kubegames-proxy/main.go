@@ -8,9 +8,12 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/kubegames/kubegames-proxy/pkg/proxy"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -19,10 +22,21 @@ import (
 
 //config cmd
 var (
-	help       bool
-	port       int64
-	cfg        string
-	kubeconfig string
+	help         bool
+	port         int64
+	cfg          string
+	kubeconfig   string
+	snapshot     string
+	interval     time.Duration
+	proxyRoute   bool
+	ingressClass string
+	gatewayClass string
+	staticRoutes string
+	file         string
+	standalone   bool
+	endpoints    bool
+	drainGrace   time.Duration
+	resync       time.Duration
 )
 
 func init() {
@@ -36,48 +50,48 @@ func init() {
 		flag.StringVar(&kubeconfig, "kubeconfig", "", "(optional) kubeconfig absolute path to the file")
 		flag.StringVar(&kubeconfig, "k", "", "(optional) kubeconfig absolute path to the file")
 	}
-	flag.Parse()
+	flag.StringVar(&snapshot, "snapshot", "", "(optional) route table snapshot file, loaded at start and written every snapshot-interval")
+	flag.DurationVar(&interval, "snapshot-interval", 10*time.Second, "route table snapshot write interval")
+	flag.BoolVar(&proxyRoute, "proxy-route", false, "(optional) route ProxyRoute resources, the crd must be installed")
+	flag.StringVar(&ingressClass, "ingress-class", "", "(optional) route Ingress objects of the ingress class")
+	flag.StringVar(&staticRoutes, "static-routes", "", "(optional) namespace/name of the config map of static routes")
+	flag.StringVar(&gatewayClass, "gateway-class", "", "(optional) route HTTPRoute objects of gateways of the gateway class, the gateway api crds must be installed")
+	flag.StringVar(&file, "file", "", "(optional) file or directory of static routes, reloaded when files change")
+	flag.BoolVar(&endpoints, "endpoint-slices", false, "(optional) route annotated services to their ready endpoints by endpoint slices instead of their cluster ip")
+	flag.DurationVar(&drainGrace, "drain-grace", 30*time.Second, "terminating pods drain for drain-grace and are then removed, with ConsistentHash they only get the requests of their hash keys, with other balances no new requests unless no live backend is left")
+	flag.DurationVar(&resync, "resync", 5*time.Minute, "every pod and service is reconciled again every resync, 0 disables it")
+	flag.BoolVar(&standalone, "standalone", false, "(optional) run without kubeconfig and cluster, only file routes are served")
 }
 
 func main() {
 	//flag
+	flag.Parse()
 	if help {
 		flag.Usage()
 		return
 	}
 
-	//nee k8s client
-	var config *rest.Config
-	var err error
-
-	if len(kubeconfig) > 0 {
-		if config, err = clientcmd.BuildConfigFromFlags("", kubeconfig); err != nil {
-			panic(err.Error())
-		}
-	} else {
-		if config, err = rest.InClusterConfig(); err != nil {
-			panic(err.Error())
-		}
+	//annotation commands (encode, decode, lint, explain)
+	if flag.NArg() > 0 {
+		os.Exit(command(flag.Args()))
 	}
 
-	kubeClient, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		panic(err)
-	}
+	//new k8s client, none without cluster
+	kubeClient, dynamicClient := clients()
 
 	//new with cancel context
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	//listen signal
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	defer close(c)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGQUIT)
 
 	//run server
 	go func() {
 		//start
-		app := proxy.NewProxyApp(fmt.Sprintf(":%d", port), kubeClient)
+		app := proxy.NewProxyApp(fmt.Sprintf(":%d", port), kubeClient, options(dynamicClient)...)
 		if err := app.Start(ctx); err != nil {
 			panic(err.Error())
 		}
@@ -90,3 +104,70 @@ func main() {
 		log.Fatalf("received signal %s", signal)
 	}
 }
+
+//k8s clients of kubeconfig or in cluster config, nil standalone
+func clients() (kubernetes.Interface, dynamic.Interface) {
+	if standalone {
+		return nil, nil
+	}
+
+	var config *rest.Config
+	var err error
+	if len(kubeconfig) > 0 {
+		if config, err = clientcmd.BuildConfigFromFlags("", kubeconfig); err != nil {
+			panic(err.Error())
+		}
+	} else {
+		if config, err = rest.InClusterConfig(); err != nil {
+			panic(err.Error())
+		}
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+
+	//new dynamic client
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	return kubeClient, dynamicClient
+}
+
+//proxy options of flags, standalone only serves snapshot and file routes
+func options(dynamicClient dynamic.Interface) []proxy.Option {
+	var opts []proxy.Option
+	if len(snapshot) > 0 {
+		opts = append(opts, proxy.WithSnapshot(snapshot, interval))
+	}
+	if len(file) > 0 {
+		opts = append(opts, proxy.WithFileRoutes(file))
+	}
+	if standalone {
+		return opts
+	}
+
+	opts = append(opts, proxy.WithDrainGrace(drainGrace), proxy.WithResync(resync))
+	if endpoints {
+		opts = append(opts, proxy.WithEndpointSlices())
+	}
+	if proxyRoute {
+		opts = append(opts, proxy.WithProxyRoute(dynamicClient))
+	}
+	if len(ingressClass) > 0 {
+		opts = append(opts, proxy.WithIngress(ingressClass))
+	}
+	if len(gatewayClass) > 0 {
+		opts = append(opts, proxy.WithGateway(dynamicClient, gatewayClass))
+	}
+	if len(staticRoutes) > 0 {
+		namespace, name := "default", staticRoutes
+		if index := strings.Index(staticRoutes, "/"); index >= 0 {
+			namespace, name = staticRoutes[:index], staticRoutes[index+1:]
+		}
+		opts = append(opts, proxy.WithStaticRoutes(namespace, name))
+	}
+	return opts
+}
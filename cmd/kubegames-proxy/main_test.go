@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/pkg/proxy"
+)
+
+//free local port
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestStandalone(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "game %s", r.URL.Path)
+	}))
+	defer backend.Close()
+
+	dir, err := ioutil.TempDir("", "routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rules := fmt.Sprintf("Items:\n- Method: GET\n  AgentUrl: /api/game\n  ProxyUrl: /game\n  Backends: [%s]\n", backend.URL)
+	if err := ioutil.WriteFile(filepath.Join(dir, "game.yaml"), []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	//no cluster client and only file routes, a kubeconfig is not read
+	standalone, file, kubeconfig, proxyRoute = true, dir, "/nonexistent/kube.config", true
+	kubeClient, dynamicClient := clients()
+	if kubeClient != nil || dynamicClient != nil {
+		t.Fatal("standalone should have no clients")
+	}
+	opts := options(dynamicClient)
+	if len(opts) != 1 {
+		t.Fatalf("standalone options %d, only file routes expected", len(opts))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	app := proxy.NewProxyApp(addr, kubeClient, opts...)
+	go app.Start(ctx)
+
+	//proxied once the server listens
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get("http://" + addr + "/api/game")
+		if err == nil {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || string(body) != "game /game" {
+				t.Fatalf("status %d body %s", resp.StatusCode, body)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
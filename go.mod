@@ -3,8 +3,10 @@ module github.com/kubegames/kubegames-proxy
 go 1.16
 
 require (
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/sirupsen/logrus v1.8.1
 	k8s.io/api v0.23.0
 	k8s.io/apimachinery v0.23.0
 	k8s.io/client-go v0.23.0
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -9,6 +9,7 @@ import (
 	"k8s.io/client-go/informers"
 	configmapV1 "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 )
 
 type (
@@ -36,7 +37,7 @@ type (
 
 	//configmap impl
 	configMapImpl struct {
-		clientset *kubernetes.Clientset
+		clientset kubernetes.Interface
 		informer  configmapV1.ConfigMapInformer
 		factory   informers.SharedInformerFactory
 	}
@@ -50,7 +51,7 @@ type (
 )
 
 //new configmap
-func NewConfigMap(clientset *kubernetes.Clientset, factory informers.SharedInformerFactory) ConfigMap {
+func NewConfigMap(clientset kubernetes.Interface, factory informers.SharedInformerFactory) ConfigMap {
 	//new config map
 	j := &configMapImpl{
 		clientset: clientset,
@@ -150,9 +151,13 @@ func (j ConfigMapHandlerFuncs) OnUpdate(oldObj, newObj interface{}) {
 	}
 }
 
-// OnDelete calls DeleteFunc if it's not nil.
+// OnDelete calls DeleteFunc if it's not nil, the last known object of
+// a delete missed by the watch is taken from its tombstone.
 func (j ConfigMapHandlerFuncs) OnDelete(obj interface{}) {
 	if j.DeleteFunc != nil {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
 		if event, ok := obj.(*coreV1.ConfigMap); ok {
 			j.DeleteFunc(event)
 		}
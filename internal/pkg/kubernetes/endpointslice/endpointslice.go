@@ -0,0 +1,162 @@
+package endpointslice
+
+import (
+	"context"
+
+	discoveryV1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	endpointSliceV1 "k8s.io/client-go/informers/discovery/v1"
+	"k8s.io/client-go/kubernetes"
+	listerV1 "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+type (
+	//endpoint slice interface
+	EndpointSlice interface {
+
+		//create endpoint slice
+		Create(ctx context.Context, namespace string, endpointSlice *discoveryV1.EndpointSlice) error
+
+		//delete endpoint slice
+		Delete(ctx context.Context, namespace string, name string) error
+
+		//list endpoint slice
+		List(ctx context.Context, namespace string, selector labels.Selector) ([]*discoveryV1.EndpointSlice, error)
+
+		//get endpoint slice
+		Get(ctx context.Context, namespace string, name string) (*discoveryV1.EndpointSlice, error)
+
+		//lister of the informer cache, synced once WatchEvent returns
+		Lister() listerV1.EndpointSliceLister
+
+		//watch event handler
+		WatchEvent(ctx context.Context, handler EndpointSliceHandlerFuncs)
+	}
+
+	//endpoint slice object
+	endpointSliceImpl struct {
+		clientset kubernetes.Interface
+		informer  endpointSliceV1.EndpointSliceInformer
+		factory   informers.SharedInformerFactory
+	}
+
+	// EndpointSliceHandlerFuncs
+	EndpointSliceHandlerFuncs struct {
+		AddFunc    func(obj *discoveryV1.EndpointSlice)
+		UpdateFunc func(oldObj, newObj *discoveryV1.EndpointSlice)
+		DeleteFunc func(obj *discoveryV1.EndpointSlice)
+	}
+)
+
+//new endpoint slice
+func NewEndpointSlice(clientset kubernetes.Interface, factory informers.SharedInformerFactory) EndpointSlice {
+	//new endpoint slice
+	p := &endpointSliceImpl{
+		clientset: clientset,
+		informer:  factory.Discovery().V1().EndpointSlices(),
+		factory:   factory,
+	}
+	return p
+}
+
+//create endpoint slice
+func (p *endpointSliceImpl) Create(ctx context.Context, namespace string, endpointSlice *discoveryV1.EndpointSlice) error {
+	_, err := p.clientset.DiscoveryV1().EndpointSlices(namespace).Create(ctx, endpointSlice, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//delete endpoint slice
+func (p *endpointSliceImpl) Delete(ctx context.Context, namespace string, name string) error {
+	err := p.clientset.DiscoveryV1().EndpointSlices(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//list endpoint slice
+func (p *endpointSliceImpl) List(ctx context.Context, namespace string, selector labels.Selector) (list []*discoveryV1.EndpointSlice, err error) {
+	list, err = p.informer.Lister().EndpointSlices(namespace).List(selector)
+	if err != nil || len(list) <= 0 {
+		endpointSlice, err := p.clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, err
+		}
+		for i := range endpointSlice.Items {
+			list = append(list, &endpointSlice.Items[i])
+		}
+	}
+	return list, nil
+}
+
+//get endpoint slice
+func (p *endpointSliceImpl) Get(ctx context.Context, namespace string, name string) (*discoveryV1.EndpointSlice, error) {
+	endpointSlice, err := p.informer.Lister().EndpointSlices(namespace).Get(name)
+	if err != nil {
+		endpointSlice, err = p.clientset.DiscoveryV1().EndpointSlices(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return endpointSlice, nil
+}
+
+//lister
+func (p *endpointSliceImpl) Lister() listerV1.EndpointSliceLister {
+	return p.informer.Lister()
+}
+
+//watch event
+func (p *endpointSliceImpl) WatchEvent(ctx context.Context, handler EndpointSliceHandlerFuncs) {
+	//add event handler
+	p.informer.Informer().AddEventHandler(handler)
+
+	//start
+	p.factory.Start(ctx.Done())
+
+	//wait sync
+	p.factory.WaitForCacheSync(ctx.Done())
+}
+
+// OnAdd calls AddFunc if it's not nil.
+func (j EndpointSliceHandlerFuncs) OnAdd(obj interface{}) {
+	if j.AddFunc != nil {
+		if event, ok := obj.(*discoveryV1.EndpointSlice); ok {
+			j.AddFunc(event)
+		}
+	}
+}
+
+// OnUpdate calls UpdateFunc if it's not nil.
+func (j EndpointSliceHandlerFuncs) OnUpdate(oldObj, newObj interface{}) {
+	if j.UpdateFunc != nil {
+		old, ok := oldObj.(*discoveryV1.EndpointSlice)
+		if !ok {
+			return
+		}
+		new, ok := newObj.(*discoveryV1.EndpointSlice)
+		if !ok {
+			return
+		}
+		j.UpdateFunc(old, new)
+	}
+}
+
+// OnDelete calls DeleteFunc if it's not nil, the last known object of
+// a delete missed by the watch is taken from its tombstone.
+func (j EndpointSliceHandlerFuncs) OnDelete(obj interface{}) {
+	if j.DeleteFunc != nil {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if event, ok := obj.(*discoveryV1.EndpointSlice); ok {
+			j.DeleteFunc(event)
+		}
+	}
+}
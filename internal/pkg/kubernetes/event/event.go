@@ -3,11 +3,11 @@ package event
 import (
 	"context"
 
-	v1 "k8s.io/api/events/v1beta1"
+	v1 "k8s.io/api/events/v1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/informers"
-	eventsV1 "k8s.io/client-go/informers/events/v1beta1"
+	eventsV1 "k8s.io/client-go/informers/events/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -15,6 +15,9 @@ type (
 	//event interface
 	Event interface {
 
+		//create event
+		Create(ctx context.Context, namespace string, event *v1.Event) error
+
 		//delete event
 		Delete(ctx context.Context, namespace string, name string) error
 
@@ -30,7 +33,7 @@ type (
 
 	//event
 	eventImpl struct {
-		clientset *kubernetes.Clientset
+		clientset kubernetes.Interface
 		informer  eventsV1.EventInformer
 		factory   informers.SharedInformerFactory
 		handler   EventHandlerFuncs
@@ -45,19 +48,28 @@ type (
 )
 
 //new event
-func NewEvent(clientset *kubernetes.Clientset, factory informers.SharedInformerFactory) Event {
+func NewEvent(clientset kubernetes.Interface, factory informers.SharedInformerFactory) Event {
 	//new event
 	e := &eventImpl{
-		informer:  factory.Events().V1beta1().Events(),
+		informer:  factory.Events().V1().Events(),
 		clientset: clientset,
 		factory:   factory,
 	}
 	return e
 }
 
+//create event
+func (e *eventImpl) Create(ctx context.Context, namespace string, event *v1.Event) error {
+	_, err := e.clientset.EventsV1().Events(namespace).Create(ctx, event, metaV1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 //delete event
 func (e *eventImpl) Delete(ctx context.Context, namespace string, name string) error {
-	err := e.clientset.EventsV1beta1().Events(namespace).Delete(ctx, name, metaV1.DeleteOptions{})
+	err := e.clientset.EventsV1().Events(namespace).Delete(ctx, name, metaV1.DeleteOptions{})
 	if err != nil {
 		return err
 	}
@@ -66,7 +78,7 @@ func (e *eventImpl) Delete(ctx context.Context, namespace string, name string) e
 
 //list event
 func (e *eventImpl) List(ctx context.Context, namespace string, fieldselector fields.Selector) (list []*v1.Event, err error) {
-	events, err := e.clientset.EventsV1beta1().Events(namespace).List(ctx, metaV1.ListOptions{
+	events, err := e.clientset.EventsV1().Events(namespace).List(ctx, metaV1.ListOptions{
 		FieldSelector: fieldselector.String(),
 	})
 	if err != nil {
@@ -82,7 +94,7 @@ func (e *eventImpl) List(ctx context.Context, namespace string, fieldselector fi
 func (e *eventImpl) Get(ctx context.Context, namespace string, name string) (event *v1.Event, err error) {
 	event, err = e.informer.Lister().Events(namespace).Get(name)
 	if err != nil {
-		event, err = e.clientset.EventsV1beta1().Events(namespace).Get(ctx, name, metaV1.GetOptions{})
+		event, err = e.clientset.EventsV1().Events(namespace).Get(ctx, name, metaV1.GetOptions{})
 		if err != nil {
 			return nil, err
 		}
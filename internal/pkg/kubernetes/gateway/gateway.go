@@ -0,0 +1,125 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kubegames/kubegames-proxy/pkg/apis/gateway"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+type (
+	//gateway interface
+	Gateway interface {
+
+		//get gateway of the informer cache
+		Get(ctx context.Context, namespace string, name string) (*gateway.Gateway, error)
+
+		//watch event handler
+		WatchEvent(ctx context.Context, handler GatewayHandlerFuncs)
+	}
+
+	//gateway object
+	gatewayImpl struct {
+		client   dynamic.Interface
+		informer informers.GenericInformer
+		factory  dynamicinformer.DynamicSharedInformerFactory
+	}
+
+	// GatewayHandlerFuncs
+	GatewayHandlerFuncs struct {
+		AddFunc    func(obj *gateway.Gateway)
+		UpdateFunc func(oldObj, newObj *gateway.Gateway)
+		DeleteFunc func(obj *gateway.Gateway)
+	}
+)
+
+//new gateway
+func NewGateway(client dynamic.Interface, factory dynamicinformer.DynamicSharedInformerFactory) Gateway {
+	//new gateway
+	g := &gatewayImpl{
+		client:   client,
+		informer: factory.ForResource(gateway.GatewayResource),
+		factory:  factory,
+	}
+	return g
+}
+
+//get gateway
+func (g *gatewayImpl) Get(ctx context.Context, namespace string, name string) (*gateway.Gateway, error) {
+	obj, err := g.informer.Lister().ByNamespace(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("gateway %s/%s is %T", namespace, name, obj)
+	}
+	return gateway.GatewayFromUnstructured(u)
+}
+
+//watch event
+func (g *gatewayImpl) WatchEvent(ctx context.Context, handler GatewayHandlerFuncs) {
+	//add event handler
+	g.informer.Informer().AddEventHandler(handler)
+
+	//start
+	g.factory.Start(ctx.Done())
+
+	//wait sync
+	g.factory.WaitForCacheSync(ctx.Done())
+}
+
+// OnAdd calls AddFunc if it's not nil.
+func (j GatewayHandlerFuncs) OnAdd(obj interface{}) {
+	if j.AddFunc != nil {
+		if event, ok := gatewayOf(obj); ok {
+			j.AddFunc(event)
+		}
+	}
+}
+
+// OnUpdate calls UpdateFunc if it's not nil.
+func (j GatewayHandlerFuncs) OnUpdate(oldObj, newObj interface{}) {
+	if j.UpdateFunc != nil {
+		old, ok := gatewayOf(oldObj)
+		if !ok {
+			return
+		}
+		new, ok := gatewayOf(newObj)
+		if !ok {
+			return
+		}
+		j.UpdateFunc(old, new)
+	}
+}
+
+// OnDelete calls DeleteFunc if it's not nil, the last known object of
+// a delete missed by the watch is taken from its tombstone.
+func (j GatewayHandlerFuncs) OnDelete(obj interface{}) {
+	if j.DeleteFunc != nil {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if event, ok := gatewayOf(obj); ok {
+			j.DeleteFunc(event)
+		}
+	}
+}
+
+//gateway of informer object
+func gatewayOf(obj interface{}) (*gateway.Gateway, bool) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, false
+	}
+	g, err := gateway.GatewayFromUnstructured(u)
+	if err != nil {
+		return nil, false
+	}
+	return g, true
+}
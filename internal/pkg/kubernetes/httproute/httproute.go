@@ -0,0 +1,166 @@
+package httproute
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kubegames/kubegames-proxy/pkg/apis/gateway"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+type (
+	//http route interface
+	HTTPRoute interface {
+
+		//list http routes
+		List(ctx context.Context, namespace string, selector labels.Selector) ([]*gateway.HTTPRoute, error)
+
+		//get http route of the informer cache
+		Get(ctx context.Context, namespace string, name string) (*gateway.HTTPRoute, error)
+
+		//update http route status
+		UpdateStatus(ctx context.Context, httpRoute *gateway.HTTPRoute) error
+
+		//watch event handler
+		WatchEvent(ctx context.Context, handler HTTPRouteHandlerFuncs)
+	}
+
+	//http route object
+	httpRouteImpl struct {
+		client   dynamic.Interface
+		informer informers.GenericInformer
+		factory  dynamicinformer.DynamicSharedInformerFactory
+	}
+
+	// HTTPRouteHandlerFuncs
+	HTTPRouteHandlerFuncs struct {
+		AddFunc    func(obj *gateway.HTTPRoute)
+		UpdateFunc func(oldObj, newObj *gateway.HTTPRoute)
+		DeleteFunc func(obj *gateway.HTTPRoute)
+	}
+)
+
+//new http route
+func NewHTTPRoute(client dynamic.Interface, factory dynamicinformer.DynamicSharedInformerFactory) HTTPRoute {
+	//new http route
+	p := &httpRouteImpl{
+		client:   client,
+		informer: factory.ForResource(gateway.HTTPRouteResource),
+		factory:  factory,
+	}
+	return p
+}
+
+//list http routes
+func (p *httpRouteImpl) List(ctx context.Context, namespace string, selector labels.Selector) (list []*gateway.HTTPRoute, err error) {
+	objs, err := p.informer.Lister().ByNamespace(namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		httpRoute, err := gateway.HTTPRouteFromUnstructured(u)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, httpRoute)
+	}
+	return list, nil
+}
+
+//get http route
+func (p *httpRouteImpl) Get(ctx context.Context, namespace string, name string) (*gateway.HTTPRoute, error) {
+	obj, err := p.informer.Lister().ByNamespace(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("http route %s/%s is %T", namespace, name, obj)
+	}
+	return gateway.HTTPRouteFromUnstructured(u)
+}
+
+//update http route status
+func (p *httpRouteImpl) UpdateStatus(ctx context.Context, httpRoute *gateway.HTTPRoute) error {
+	u, err := httpRoute.ToUnstructured()
+	if err != nil {
+		return err
+	}
+	_, err = p.client.Resource(gateway.HTTPRouteResource).Namespace(httpRoute.Namespace).UpdateStatus(ctx, u, metaV1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//watch event
+func (p *httpRouteImpl) WatchEvent(ctx context.Context, handler HTTPRouteHandlerFuncs) {
+	//add event handler
+	p.informer.Informer().AddEventHandler(handler)
+
+	//start
+	p.factory.Start(ctx.Done())
+
+	//wait sync
+	p.factory.WaitForCacheSync(ctx.Done())
+}
+
+// OnAdd calls AddFunc if it's not nil.
+func (j HTTPRouteHandlerFuncs) OnAdd(obj interface{}) {
+	if j.AddFunc != nil {
+		if event, ok := httpRoute(obj); ok {
+			j.AddFunc(event)
+		}
+	}
+}
+
+// OnUpdate calls UpdateFunc if it's not nil.
+func (j HTTPRouteHandlerFuncs) OnUpdate(oldObj, newObj interface{}) {
+	if j.UpdateFunc != nil {
+		old, ok := httpRoute(oldObj)
+		if !ok {
+			return
+		}
+		new, ok := httpRoute(newObj)
+		if !ok {
+			return
+		}
+		j.UpdateFunc(old, new)
+	}
+}
+
+// OnDelete calls DeleteFunc if it's not nil, the last known object of
+// a delete missed by the watch is taken from its tombstone.
+func (j HTTPRouteHandlerFuncs) OnDelete(obj interface{}) {
+	if j.DeleteFunc != nil {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if event, ok := httpRoute(obj); ok {
+			j.DeleteFunc(event)
+		}
+	}
+}
+
+//http route of informer object
+func httpRoute(obj interface{}) (*gateway.HTTPRoute, bool) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, false
+	}
+	p, err := gateway.HTTPRouteFromUnstructured(u)
+	if err != nil {
+		return nil, false
+	}
+	return p, true
+}
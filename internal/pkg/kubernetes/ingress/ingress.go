@@ -0,0 +1,162 @@
+package ingress
+
+import (
+	"context"
+
+	networkingV1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	ingressV1 "k8s.io/client-go/informers/networking/v1"
+	"k8s.io/client-go/kubernetes"
+	listerV1 "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+type (
+	//ingress interface
+	Ingress interface {
+
+		//create ingress
+		Create(ctx context.Context, namespace string, ingress *networkingV1.Ingress) error
+
+		//delete ingress
+		Delete(ctx context.Context, namespace string, name string) error
+
+		//list ingress
+		List(ctx context.Context, namespace string, selector labels.Selector) ([]*networkingV1.Ingress, error)
+
+		//get ingress
+		Get(ctx context.Context, namespace string, name string) (*networkingV1.Ingress, error)
+
+		//lister of the informer cache, synced once WatchEvent returns
+		Lister() listerV1.IngressLister
+
+		//watch event handler
+		WatchEvent(ctx context.Context, handler IngressHandlerFuncs)
+	}
+
+	//ingress object
+	ingressImpl struct {
+		clientset kubernetes.Interface
+		informer  ingressV1.IngressInformer
+		factory   informers.SharedInformerFactory
+	}
+
+	// IngressHandlerFuncs
+	IngressHandlerFuncs struct {
+		AddFunc    func(obj *networkingV1.Ingress)
+		UpdateFunc func(oldObj, newObj *networkingV1.Ingress)
+		DeleteFunc func(obj *networkingV1.Ingress)
+	}
+)
+
+//new ingress
+func NewIngress(clientset kubernetes.Interface, factory informers.SharedInformerFactory) Ingress {
+	//new ingress
+	p := &ingressImpl{
+		clientset: clientset,
+		informer:  factory.Networking().V1().Ingresses(),
+		factory:   factory,
+	}
+	return p
+}
+
+//create ingress
+func (p *ingressImpl) Create(ctx context.Context, namespace string, ingress *networkingV1.Ingress) error {
+	_, err := p.clientset.NetworkingV1().Ingresses(namespace).Create(ctx, ingress, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//delete ingress
+func (p *ingressImpl) Delete(ctx context.Context, namespace string, name string) error {
+	err := p.clientset.NetworkingV1().Ingresses(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//list ingress
+func (p *ingressImpl) List(ctx context.Context, namespace string, selector labels.Selector) (list []*networkingV1.Ingress, err error) {
+	list, err = p.informer.Lister().Ingresses(namespace).List(selector)
+	if err != nil || len(list) <= 0 {
+		ingress, err := p.clientset.NetworkingV1().Ingresses(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, err
+		}
+		for i := range ingress.Items {
+			list = append(list, &ingress.Items[i])
+		}
+	}
+	return list, nil
+}
+
+//get ingress
+func (p *ingressImpl) Get(ctx context.Context, namespace string, name string) (*networkingV1.Ingress, error) {
+	ingress, err := p.informer.Lister().Ingresses(namespace).Get(name)
+	if err != nil {
+		ingress, err = p.clientset.NetworkingV1().Ingresses(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ingress, nil
+}
+
+//lister
+func (p *ingressImpl) Lister() listerV1.IngressLister {
+	return p.informer.Lister()
+}
+
+//watch event
+func (p *ingressImpl) WatchEvent(ctx context.Context, handler IngressHandlerFuncs) {
+	//add event handler
+	p.informer.Informer().AddEventHandler(handler)
+
+	//start
+	p.factory.Start(ctx.Done())
+
+	//wait sync
+	p.factory.WaitForCacheSync(ctx.Done())
+}
+
+// OnAdd calls AddFunc if it's not nil.
+func (j IngressHandlerFuncs) OnAdd(obj interface{}) {
+	if j.AddFunc != nil {
+		if event, ok := obj.(*networkingV1.Ingress); ok {
+			j.AddFunc(event)
+		}
+	}
+}
+
+// OnUpdate calls UpdateFunc if it's not nil.
+func (j IngressHandlerFuncs) OnUpdate(oldObj, newObj interface{}) {
+	if j.UpdateFunc != nil {
+		old, ok := oldObj.(*networkingV1.Ingress)
+		if !ok {
+			return
+		}
+		new, ok := newObj.(*networkingV1.Ingress)
+		if !ok {
+			return
+		}
+		j.UpdateFunc(old, new)
+	}
+}
+
+// OnDelete calls DeleteFunc if it's not nil, the last known object of
+// a delete missed by the watch is taken from its tombstone.
+func (j IngressHandlerFuncs) OnDelete(obj interface{}) {
+	if j.DeleteFunc != nil {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if event, ok := obj.(*networkingV1.Ingress); ok {
+			j.DeleteFunc(event)
+		}
+	}
+}
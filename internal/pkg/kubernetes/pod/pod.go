@@ -9,6 +9,8 @@ import (
 	"k8s.io/client-go/informers"
 	podsV1 "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
+	listerV1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 type (
@@ -27,13 +29,16 @@ type (
 		//get pods
 		Get(ctx context.Context, namespace string, name string) (*coreV1.Pod, error)
 
+		//lister of the informer cache, synced once WatchEvent returns
+		Lister() listerV1.PodLister
+
 		//watch event handler
 		WatchEvent(ctx context.Context, handler PodHandlerFuncs)
 	}
 
 	//pod object
 	podImpl struct {
-		clientset *kubernetes.Clientset
+		clientset kubernetes.Interface
 		informer  podsV1.PodInformer
 		factory   informers.SharedInformerFactory
 	}
@@ -47,7 +52,7 @@ type (
 )
 
 //new pod
-func NewPod(clientset *kubernetes.Clientset, factory informers.SharedInformerFactory) Pod {
+func NewPod(clientset kubernetes.Interface, factory informers.SharedInformerFactory) Pod {
 	//new pod
 	p := &podImpl{
 		clientset: clientset,
@@ -102,6 +107,11 @@ func (p *podImpl) Get(ctx context.Context, namespace string, name string) (*core
 	return pod, nil
 }
 
+//lister
+func (p *podImpl) Lister() listerV1.PodLister {
+	return p.informer.Lister()
+}
+
 //watch event
 func (p *podImpl) WatchEvent(ctx context.Context, handler PodHandlerFuncs) {
 	//add event handler
@@ -138,9 +148,13 @@ func (j PodHandlerFuncs) OnUpdate(oldObj, newObj interface{}) {
 	}
 }
 
-// OnDelete calls DeleteFunc if it's not nil.
+// OnDelete calls DeleteFunc if it's not nil, the last known object of
+// a delete missed by the watch is taken from its tombstone.
 func (j PodHandlerFuncs) OnDelete(obj interface{}) {
 	if j.DeleteFunc != nil {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
 		if event, ok := obj.(*coreV1.Pod); ok {
 			j.DeleteFunc(event)
 		}
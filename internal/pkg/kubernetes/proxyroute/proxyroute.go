@@ -0,0 +1,166 @@
+package proxyroute
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kubegames/kubegames-proxy/pkg/apis/v1alpha1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+type (
+	//proxy route interface
+	ProxyRoute interface {
+
+		//list proxy routes
+		List(ctx context.Context, namespace string, selector labels.Selector) ([]*v1alpha1.ProxyRoute, error)
+
+		//get proxy route of the informer cache
+		Get(ctx context.Context, namespace string, name string) (*v1alpha1.ProxyRoute, error)
+
+		//update proxy route status
+		UpdateStatus(ctx context.Context, proxyRoute *v1alpha1.ProxyRoute) error
+
+		//watch event handler
+		WatchEvent(ctx context.Context, handler ProxyRouteHandlerFuncs)
+	}
+
+	//proxy route object
+	proxyRouteImpl struct {
+		client   dynamic.Interface
+		informer informers.GenericInformer
+		factory  dynamicinformer.DynamicSharedInformerFactory
+	}
+
+	// ProxyRouteHandlerFuncs
+	ProxyRouteHandlerFuncs struct {
+		AddFunc    func(obj *v1alpha1.ProxyRoute)
+		UpdateFunc func(oldObj, newObj *v1alpha1.ProxyRoute)
+		DeleteFunc func(obj *v1alpha1.ProxyRoute)
+	}
+)
+
+//new proxy route
+func NewProxyRoute(client dynamic.Interface, factory dynamicinformer.DynamicSharedInformerFactory) ProxyRoute {
+	//new proxy route
+	p := &proxyRouteImpl{
+		client:   client,
+		informer: factory.ForResource(v1alpha1.ProxyRouteResource),
+		factory:  factory,
+	}
+	return p
+}
+
+//list proxy routes
+func (p *proxyRouteImpl) List(ctx context.Context, namespace string, selector labels.Selector) (list []*v1alpha1.ProxyRoute, err error) {
+	objs, err := p.informer.Lister().ByNamespace(namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		proxyRoute, err := v1alpha1.FromUnstructured(u)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, proxyRoute)
+	}
+	return list, nil
+}
+
+//get proxy route
+func (p *proxyRouteImpl) Get(ctx context.Context, namespace string, name string) (*v1alpha1.ProxyRoute, error) {
+	obj, err := p.informer.Lister().ByNamespace(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("proxy route %s/%s is %T", namespace, name, obj)
+	}
+	return v1alpha1.FromUnstructured(u)
+}
+
+//update proxy route status
+func (p *proxyRouteImpl) UpdateStatus(ctx context.Context, proxyRoute *v1alpha1.ProxyRoute) error {
+	u, err := proxyRoute.ToUnstructured()
+	if err != nil {
+		return err
+	}
+	_, err = p.client.Resource(v1alpha1.ProxyRouteResource).Namespace(proxyRoute.Namespace).UpdateStatus(ctx, u, metaV1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//watch event
+func (p *proxyRouteImpl) WatchEvent(ctx context.Context, handler ProxyRouteHandlerFuncs) {
+	//add event handler
+	p.informer.Informer().AddEventHandler(handler)
+
+	//start
+	p.factory.Start(ctx.Done())
+
+	//wait sync
+	p.factory.WaitForCacheSync(ctx.Done())
+}
+
+// OnAdd calls AddFunc if it's not nil.
+func (j ProxyRouteHandlerFuncs) OnAdd(obj interface{}) {
+	if j.AddFunc != nil {
+		if event, ok := proxyRoute(obj); ok {
+			j.AddFunc(event)
+		}
+	}
+}
+
+// OnUpdate calls UpdateFunc if it's not nil.
+func (j ProxyRouteHandlerFuncs) OnUpdate(oldObj, newObj interface{}) {
+	if j.UpdateFunc != nil {
+		old, ok := proxyRoute(oldObj)
+		if !ok {
+			return
+		}
+		new, ok := proxyRoute(newObj)
+		if !ok {
+			return
+		}
+		j.UpdateFunc(old, new)
+	}
+}
+
+// OnDelete calls DeleteFunc if it's not nil, the last known object of
+// a delete missed by the watch is taken from its tombstone.
+func (j ProxyRouteHandlerFuncs) OnDelete(obj interface{}) {
+	if j.DeleteFunc != nil {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if event, ok := proxyRoute(obj); ok {
+			j.DeleteFunc(event)
+		}
+	}
+}
+
+//proxy route of informer object
+func proxyRoute(obj interface{}) (*v1alpha1.ProxyRoute, bool) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, false
+	}
+	p, err := v1alpha1.FromUnstructured(u)
+	if err != nil {
+		return nil, false
+	}
+	return p, true
+}
@@ -9,6 +9,8 @@ import (
 	"k8s.io/client-go/informers"
 	serviceV1 "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
+	listerV1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 type (
@@ -27,13 +29,16 @@ type (
 		//get service
 		Get(ctx context.Context, namespace string, name string) (*coreV1.Service, error)
 
+		//lister of the informer cache, synced once WatchEvent returns
+		Lister() listerV1.ServiceLister
+
 		//watch event handler
 		WatchEvent(ctx context.Context, handler ServiceHandlerFuncs)
 	}
 
 	//service object
 	serviceImpl struct {
-		clientset *kubernetes.Clientset
+		clientset kubernetes.Interface
 		informer  serviceV1.ServiceInformer
 		factory   informers.SharedInformerFactory
 	}
@@ -47,7 +52,7 @@ type (
 )
 
 //new service
-func NewService(clientset *kubernetes.Clientset, factory informers.SharedInformerFactory) Service {
+func NewService(clientset kubernetes.Interface, factory informers.SharedInformerFactory) Service {
 	//new service
 	p := &serviceImpl{
 		clientset: clientset,
@@ -102,6 +107,11 @@ func (p *serviceImpl) Get(ctx context.Context, namespace string, name string) (*
 	return service, nil
 }
 
+//lister
+func (p *serviceImpl) Lister() listerV1.ServiceLister {
+	return p.informer.Lister()
+}
+
 //watch event
 func (p *serviceImpl) WatchEvent(ctx context.Context, handler ServiceHandlerFuncs) {
 	//add event handler
@@ -138,9 +148,13 @@ func (j ServiceHandlerFuncs) OnUpdate(oldObj, newObj interface{}) {
 	}
 }
 
-// OnDelete calls DeleteFunc if it's not nil.
+// OnDelete calls DeleteFunc if it's not nil, the last known object of
+// a delete missed by the watch is taken from its tombstone.
 func (j ServiceHandlerFuncs) OnDelete(obj interface{}) {
 	if j.DeleteFunc != nil {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
 		if event, ok := obj.(*coreV1.Service); ok {
 			j.DeleteFunc(event)
 		}
@@ -0,0 +1,212 @@
+package gateway
+
+import (
+	"encoding/json"
+
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+//the fields of gateway api (gateway.networking.k8s.io/v1) routed by the proxy
+
+const (
+	//api group
+	Group   = "gateway.networking.k8s.io"
+	Version = "v1"
+	//kinds
+	KindGateway   = "Gateway"
+	KindHTTPRoute = "HTTPRoute"
+	KindService   = "Service"
+
+	//path match types
+	PathMatchPathPrefix        = "PathPrefix"
+	PathMatchExact             = "Exact"
+	PathMatchRegularExpression = "RegularExpression"
+
+	//header and query match types
+	MatchExact = "Exact"
+
+	//filter types
+	FilterURLRewrite    = "URLRewrite"
+	FilterRequestMirror = "RequestMirror"
+
+	//path modifier types
+	FullPathHTTPPathModifier    = "ReplaceFullPath"
+	PrefixMatchHTTPPathModifier = "ReplacePrefixMatch"
+)
+
+var (
+	//gateway resource
+	GatewayResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "gateways"}
+	//http route resource
+	HTTPRouteResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "httproutes"}
+)
+
+type (
+	//gateway
+	Gateway struct {
+		metaV1.TypeMeta   `json:",inline"`
+		metaV1.ObjectMeta `json:"metadata,omitempty"`
+
+		Spec GatewaySpec `json:"spec"`
+	}
+
+	//gateway spec
+	GatewaySpec struct {
+		GatewayClassName string `json:"gatewayClassName"`
+	}
+
+	//http route
+	HTTPRoute struct {
+		metaV1.TypeMeta   `json:",inline"`
+		metaV1.ObjectMeta `json:"metadata,omitempty"`
+
+		Spec   HTTPRouteSpec   `json:"spec"`
+		Status HTTPRouteStatus `json:"status,omitempty"`
+	}
+
+	//http route spec
+	HTTPRouteSpec struct {
+		ParentRefs []ParentReference `json:"parentRefs,omitempty"`
+		Hostnames  []string          `json:"hostnames,omitempty"`
+		Rules      []HTTPRouteRule   `json:"rules,omitempty"`
+	}
+
+	//gateway of route
+	ParentReference struct {
+		Group       *string `json:"group,omitempty"`
+		Kind        *string `json:"kind,omitempty"`
+		Namespace   *string `json:"namespace,omitempty"`
+		Name        string  `json:"name"`
+		SectionName *string `json:"sectionName,omitempty"`
+		Port        *int32  `json:"port,omitempty"`
+	}
+
+	//http route rule
+	HTTPRouteRule struct {
+		Matches     []HTTPRouteMatch  `json:"matches,omitempty"`
+		Filters     []HTTPRouteFilter `json:"filters,omitempty"`
+		BackendRefs []HTTPBackendRef  `json:"backendRefs,omitempty"`
+	}
+
+	//request match
+	HTTPRouteMatch struct {
+		Path        *HTTPPathMatch        `json:"path,omitempty"`
+		Headers     []HTTPHeaderMatch     `json:"headers,omitempty"`
+		QueryParams []HTTPQueryParamMatch `json:"queryParams,omitempty"`
+		Method      *string               `json:"method,omitempty"`
+	}
+
+	//path match
+	HTTPPathMatch struct {
+		Type  *string `json:"type,omitempty"`
+		Value *string `json:"value,omitempty"`
+	}
+
+	//header match
+	HTTPHeaderMatch struct {
+		Type  *string `json:"type,omitempty"`
+		Name  string  `json:"name"`
+		Value string  `json:"value"`
+	}
+
+	//query param match
+	HTTPQueryParamMatch struct {
+		Type  *string `json:"type,omitempty"`
+		Name  string  `json:"name"`
+		Value string  `json:"value"`
+	}
+
+	//request filter
+	HTTPRouteFilter struct {
+		Type          string                   `json:"type"`
+		URLRewrite    *HTTPURLRewriteFilter    `json:"urlRewrite,omitempty"`
+		RequestMirror *HTTPRequestMirrorFilter `json:"requestMirror,omitempty"`
+	}
+
+	//url rewrite filter
+	HTTPURLRewriteFilter struct {
+		Hostname *string           `json:"hostname,omitempty"`
+		Path     *HTTPPathModifier `json:"path,omitempty"`
+	}
+
+	//path rewrite
+	HTTPPathModifier struct {
+		Type               string  `json:"type"`
+		ReplaceFullPath    *string `json:"replaceFullPath,omitempty"`
+		ReplacePrefixMatch *string `json:"replacePrefixMatch,omitempty"`
+	}
+
+	//request mirror filter
+	HTTPRequestMirrorFilter struct {
+		BackendRef BackendObjectReference `json:"backendRef"`
+		Percent    *int32                 `json:"percent,omitempty"`
+	}
+
+	//backend of rule
+	HTTPBackendRef struct {
+		BackendObjectReference `json:",inline"`
+		Weight                 *int32 `json:"weight,omitempty"`
+	}
+
+	//backend object
+	BackendObjectReference struct {
+		Group     *string `json:"group,omitempty"`
+		Kind      *string `json:"kind,omitempty"`
+		Name      string  `json:"name"`
+		Namespace *string `json:"namespace,omitempty"`
+		Port      *int32  `json:"port,omitempty"`
+	}
+
+	//http route status
+	HTTPRouteStatus struct {
+		Parents []RouteParentStatus `json:"parents"`
+	}
+
+	//status of route for one gateway
+	RouteParentStatus struct {
+		ParentRef      ParentReference    `json:"parentRef"`
+		ControllerName string             `json:"controllerName"`
+		Conditions     []metaV1.Condition `json:"conditions,omitempty"`
+	}
+)
+
+//gateway of unstructured object
+func GatewayFromUnstructured(u *unstructured.Unstructured) (*Gateway, error) {
+	g := new(Gateway)
+	if err := fromUnstructured(u, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+//http route of unstructured object
+func HTTPRouteFromUnstructured(u *unstructured.Unstructured) (*HTTPRoute, error) {
+	h := new(HTTPRoute)
+	if err := fromUnstructured(u, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+//unstructured object of http route
+func (h *HTTPRoute) ToUnstructured() (*unstructured.Unstructured, error) {
+	buff, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	u := new(unstructured.Unstructured)
+	if err := u.UnmarshalJSON(buff); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func fromUnstructured(u *unstructured.Unstructured, obj interface{}) error {
+	buff, err := u.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buff, obj)
+}
@@ -0,0 +1,99 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	//api group
+	Group   = "kubegames.io"
+	Version = "v1alpha1"
+	//proxy route kind
+	KindProxyRoute = "ProxyRoute"
+)
+
+//proxy route resource
+var ProxyRouteResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "proxyroutes"}
+
+type (
+	//proxy route, rules routed to the pods or services of a selector
+	ProxyRoute struct {
+		metaV1.TypeMeta   `json:",inline"`
+		metaV1.ObjectMeta `json:"metadata,omitempty"`
+
+		Spec   ProxyRouteSpec   `json:"spec"`
+		Status ProxyRouteStatus `json:"status,omitempty"`
+
+		//first unknown or mistyped field of the decoded object, reported
+		//in the status instead of routing the spec
+		DecodeError string `json:"-"`
+	}
+
+	//proxy route spec
+	ProxyRouteSpec struct {
+		//selected kind (Pod or Service)
+		ProxyPattern route.ProxyPattern `json:"proxyPattern"`
+		//pods or services of the route namespace, every object when empty
+		Selector *metaV1.LabelSelector `json:"selector,omitempty"`
+		//rules, the same as the proxy annotation items
+		Rules []*route.Rule `json:"rules"`
+	}
+
+	//proxy route status
+	ProxyRouteStatus struct {
+		//generation of the spec routed
+		ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+		//resolved backends
+		Backends []ProxyRouteBackend `json:"backends,omitempty"`
+		//routes conflicting with other owners
+		Conflicts []string `json:"conflicts,omitempty"`
+		//rejected rules and unresolved ports
+		Errors []string `json:"errors,omitempty"`
+	}
+
+	//resolved backend of a rule
+	ProxyRouteBackend struct {
+		Kind     string `json:"kind"`
+		Name     string `json:"name"`
+		AgentUrl string `json:"agentUrl"`
+		ProxyIp  string `json:"proxyIp"`
+	}
+)
+
+//proxy route of unstructured object decoded strictly, unknown and
+//mistyped fields are skipped and the first of them is kept in DecodeError
+func FromUnstructured(u *unstructured.Unstructured) (*ProxyRoute, error) {
+	buff, err := u.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	p := new(ProxyRoute)
+	decoder := json.NewDecoder(bytes.NewReader(buff))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(p); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return nil, err
+		}
+		p.DecodeError = err.Error()
+	}
+	return p, nil
+}
+
+//unstructured object of proxy route
+func (p *ProxyRoute) ToUnstructured() (*unstructured.Unstructured, error) {
+	buff, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	u := new(unstructured.Unstructured)
+	if err := u.UnmarshalJSON(buff); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,317 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	//every pod and service is reconciled again every
+	defaultResync = 5 * time.Minute
+	//failed keys are queued again up to
+	maxRetries = 5
+	//queue workers
+	workers = 2
+	//namespace keys wait for the batch of changed pods and services
+	batchDelay = time.Second
+
+	//namespace keys, the proxy routes, the http routes or every source
+	//resolving the services of namespace are queued, every namespace
+	//when it is empty
+	kindProxyRoutes = "ProxyRoutes"
+	kindHTTPRoutes  = "HTTPRoutes"
+	kindServices    = "Services"
+)
+
+type (
+	//queued object of kind, or namespace key without name
+	queueKey struct {
+		Kind      string
+		Namespace string
+		Name      string
+	}
+)
+
+//reconcile every object again every interval, routes of objects whose
+//delete was missed are removed then
+func WithResync(interval time.Duration) Option {
+	return func(app *proxyAppImp) {
+		app.resync = interval
+	}
+}
+
+//new rate limited queue
+func newQueue() workqueue.RateLimitingInterface {
+	return workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "kubegames-proxy")
+}
+
+//queue object of kind
+func (app *proxyAppImp) enqueue(kind, namespace, name string) {
+	app.queue.Add(queueKey{Kind: kind, Namespace: namespace, Name: name})
+}
+
+//queue namespace key after the batch delay, keys added while it waits
+//are synced once
+func (app *proxyAppImp) enqueueNamespace(kind, namespace string) {
+	app.queue.AddAfter(queueKey{Kind: kind, Namespace: namespace}, batchDelay)
+}
+
+//run queue workers and resync until ctx is done
+func (app *proxyAppImp) runController(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		app.queue.ShutDown()
+	}()
+	for i := 0; i < workers; i++ {
+		go wait.Until(func() {
+			for app.processNext(ctx) {
+			}
+		}, time.Second, ctx.Done())
+	}
+	if app.resync > 0 {
+		go wait.Until(func() { app.resyncAll(ctx) }, app.resync, ctx.Done())
+	}
+}
+
+//reconcile next key, failed keys are retried with backoff
+func (app *proxyAppImp) processNext(ctx context.Context) bool {
+	item, quit := app.queue.Get()
+	if quit {
+		return false
+	}
+	defer app.queue.Done(item)
+
+	key := item.(queueKey)
+	err := app.sync(ctx, key)
+	switch {
+	case err == nil:
+		app.queue.Forget(item)
+	case app.queue.NumRequeues(item) < maxRetries:
+		log.Warnf("sync %s %s/%s err %s, retry", key.Kind, key.Namespace, key.Name, err.Error())
+		app.queue.AddRateLimited(item)
+		return true
+	default:
+		log.Errorf("sync %s %s/%s err %s, dropped", key.Kind, key.Namespace, key.Name, err.Error())
+		app.queue.Forget(item)
+	}
+	app.synced(key)
+	return true
+}
+
+//queue keys and wait until the workers reconciled each of them or ctx
+//is done, dropped keys count as reconciled
+func (app *proxyAppImp) enqueueAndWait(ctx context.Context, keys []queueKey) {
+	if len(keys) <= 0 {
+		return
+	}
+	waited := make(chan struct{})
+	app.waitLock.Lock()
+	app.waiting = make(map[queueKey]bool, len(keys))
+	for _, key := range keys {
+		app.waiting[key] = true
+	}
+	app.waited = waited
+	app.waitLock.Unlock()
+
+	for _, key := range keys {
+		app.queue.Add(key)
+	}
+	select {
+	case <-waited:
+	case <-ctx.Done():
+	}
+}
+
+//key reconciled, the waiter is released after its last key
+func (app *proxyAppImp) synced(key queueKey) {
+	app.waitLock.Lock()
+	defer app.waitLock.Unlock()
+	if !app.waiting[key] {
+		return
+	}
+	delete(app.waiting, key)
+	if len(app.waiting) <= 0 {
+		close(app.waited)
+		app.waiting = nil
+	}
+}
+
+//reconcile routes of key with the object in the informer cache, the
+//returned errors are transient and retried, invalid objects are recorded
+//as events and not retried
+func (app *proxyAppImp) sync(ctx context.Context, key queueKey) error {
+	switch key.Kind {
+	case route.KindPod:
+		obj, err := app.pod.Lister().Pods(key.Namespace).Get(key.Name)
+		switch {
+		case errors.IsNotFound(err):
+			app.deleteOwners(key, "")
+		case err != nil:
+			return err
+		default:
+			app.deleteOwners(key, string(obj.UID))
+			app.AddPodRoute(obj)
+		}
+		if app.proxyRoute != nil {
+			app.enqueueNamespace(kindProxyRoutes, key.Namespace)
+		}
+	case route.KindService:
+		obj, err := app.service.Lister().Services(key.Namespace).Get(key.Name)
+		switch {
+		case errors.IsNotFound(err):
+			app.deleteOwners(key, "")
+		case err != nil:
+			return err
+		default:
+			app.deleteOwners(key, string(obj.UID))
+			if err := app.AddServiceRoute(obj); err != nil {
+				return err
+			}
+		}
+		app.enqueueNamespace(kindServices, key.Namespace)
+	case route.KindProxyRoute:
+		if app.proxyRoute == nil {
+			app.deleteOwners(key, "")
+			return nil
+		}
+		obj, err := app.proxyRoute.Get(ctx, key.Namespace, key.Name)
+		switch {
+		case errors.IsNotFound(err):
+			app.deleteOwners(key, "")
+		case err != nil:
+			return err
+		default:
+			app.deleteOwners(key, string(obj.UID))
+			return app.AddProxyRoute(ctx, obj)
+		}
+	case route.KindIngress:
+		if app.ingress == nil {
+			app.deleteOwners(key, "")
+			return nil
+		}
+		obj, err := app.ingress.Lister().Ingresses(key.Namespace).Get(key.Name)
+		switch {
+		case errors.IsNotFound(err):
+			app.deleteOwners(key, "")
+		case err != nil:
+			return err
+		default:
+			app.deleteOwners(key, string(obj.UID))
+			app.AddIngressRoute(ctx, obj)
+		}
+	case route.KindHTTPRoute:
+		if app.httpRoute == nil {
+			app.deleteOwners(key, "")
+			return nil
+		}
+		obj, err := app.httpRoute.Get(ctx, key.Namespace, key.Name)
+		switch {
+		case errors.IsNotFound(err):
+			app.deleteOwners(key, "")
+		case err != nil:
+			return err
+		default:
+			app.deleteOwners(key, string(obj.UID))
+			return app.AddHTTPRoute(ctx, obj)
+		}
+	case kindProxyRoutes:
+		return app.enqueueProxyRoutes(ctx, key.Namespace)
+	case kindHTTPRoutes:
+		return app.enqueueHTTPRoutes(ctx, key.Namespace)
+	case kindServices:
+		if err := app.enqueueProxyRoutes(ctx, key.Namespace); err != nil {
+			return err
+		}
+		if err := app.enqueueIngresses(key.Namespace); err != nil {
+			return err
+		}
+		return app.enqueueHTTPRoutes(ctx, key.Namespace)
+	}
+	return nil
+}
+
+//delete routes of key owned by another uid, all of them when uid is empty
+func (app *proxyAppImp) deleteOwners(key queueKey, uid string) {
+	for _, owner := range app.route.OwnersOf(key.Namespace, key.Kind, key.Name) {
+		if owner.UID == uid {
+			continue
+		}
+		log.Infof("delete stale route %s", owner)
+		app.stopDrain(owner)
+		app.route.Delete(owner)
+	}
+}
+
+//keys of every object in the informer caches
+func (app *proxyAppImp) cachedKeys(ctx context.Context) ([]queueKey, error) {
+	var keys []queueKey
+	pods, err := app.pod.Lister().List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range pods {
+		keys = append(keys, queueKey{Kind: route.KindPod, Namespace: obj.Namespace, Name: obj.Name})
+	}
+	services, err := app.service.Lister().List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range services {
+		keys = append(keys, queueKey{Kind: route.KindService, Namespace: obj.Namespace, Name: obj.Name})
+	}
+	if app.proxyRoute != nil {
+		list, err := app.proxyRoute.List(ctx, "", labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range list {
+			keys = append(keys, queueKey{Kind: route.KindProxyRoute, Namespace: obj.Namespace, Name: obj.Name})
+		}
+	}
+	if app.ingress != nil {
+		list, err := app.ingress.Lister().List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range list {
+			keys = append(keys, queueKey{Kind: route.KindIngress, Namespace: obj.Namespace, Name: obj.Name})
+		}
+	}
+	if app.httpRoute != nil {
+		list, err := app.httpRoute.List(ctx, "", labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range list {
+			keys = append(keys, queueKey{Kind: route.KindHTTPRoute, Namespace: obj.Namespace, Name: obj.Name})
+		}
+	}
+	return keys, nil
+}
+
+//queue every cached object and every owner of the table
+func (app *proxyAppImp) resyncAll(ctx context.Context) {
+	keys, err := app.cachedKeys(ctx)
+	if err != nil {
+		log.Errorf("resync list err %s", err.Error())
+		return
+	}
+	for _, key := range keys {
+		app.queue.Add(key)
+	}
+
+	//owners of objects gone from the cache
+	for _, owner := range app.route.Owners() {
+		switch owner.Kind {
+		case route.KindPod, route.KindService, route.KindProxyRoute, route.KindIngress, route.KindHTTPRoute:
+			app.enqueue(owner.Kind, owner.Namespace, owner.Name)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/proxyroute"
+	"github.com/kubegames/kubegames-proxy/pkg/apis/v1alpha1"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+//running ready pod routing /api/game
+func newAnnotatedPod(name, ip, uid string) *v1.Pod {
+	obj := newTestPod(name, ip, nil)
+	obj.UID = types.UID(uid)
+	obj.Annotations = map[string]string{
+		AnnotationProxyV2: "ProxyPattern: Pod\nItems:\n- Method: GET\n  AgentUrl: /api/game\n  ProxyUrl: /game\n  Port: http\n",
+	}
+	return obj
+}
+
+func TestController(t *testing.T) {
+	app, clientset := newTestApp(t, newAnnotatedPod("game-0", "10.0.0.1", "game-0"))
+	app.queue = newQueue()
+	app.resync = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.watchPod(ctx)
+	app.watchService(ctx)
+	app.runController(ctx)
+
+	//wait until /api/game is routed to backend
+	wait := func(backend string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for backendOf(app, "/api/game") != backend {
+			if time.Now().After(deadline) {
+				t.Fatalf("/api/game routed to %q, expected %q", backendOf(app, "/api/game"), backend)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	wait("http://10.0.0.1:8080")
+
+	//pod recreated with the same name, routes of the old uid are removed
+	pods := clientset.CoreV1().Pods("default")
+	if err := pods.Delete(ctx, "game-0", metaV1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pods.Create(ctx, newAnnotatedPod("game-0", "10.0.0.2", "game-0-2"), metaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	wait("http://10.0.0.2:8080")
+	if owners := app.route.OwnersOf("default", route.KindPod, "game-0"); len(owners) != 1 || owners[0].UID != "game-0-2" {
+		t.Fatalf("owners %v", owners)
+	}
+
+	//deleted pod
+	if err := pods.Delete(ctx, "game-0", metaV1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	wait("")
+	if owners := app.route.OwnersOf("default", route.KindPod, "game-0"); len(owners) != 0 {
+		t.Fatalf("owners %v", owners)
+	}
+}
+
+func TestControllerBatch(t *testing.T) {
+	var objects []runtime.Object
+	for i := 0; i < 50; i++ {
+		objects = append(objects, newAnnotatedPod(fmt.Sprintf("game-%d", i), fmt.Sprintf("10.0.0.%d", i+1), fmt.Sprintf("game-%d", i)))
+	}
+	objects = append(objects, newTestService("game", "10.1.0.1", nil), newTestService("lobby", "10.1.0.2", nil))
+	app, _ := newTestApp(t, objects...)
+	app.proxyRoute, _ = newTestProxyRouteClient(t, newTestProxyRoute(route.Pod, nil))
+	app.queue = newQueue()
+	defer app.queue.ShutDown()
+	ctx := context.Background()
+
+	//every pod and service is synced
+	app.resyncAll(ctx)
+	if app.queue.Len() != 52 {
+		t.Fatalf("queued %d keys", app.queue.Len())
+	}
+	for app.queue.Len() > 0 {
+		app.processNext(ctx)
+	}
+	if len(app.route.Owners()) != 50 {
+		t.Fatalf("owners %d", len(app.route.Owners()))
+	}
+
+	//proxy routes and services of the namespace are synced once for the batch
+	deadline := time.Now().Add(5 * time.Second)
+	for app.queue.Len() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued %d namespace keys", app.queue.Len())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if app.queue.Len() != 2 {
+		t.Fatalf("queued %d namespace keys", app.queue.Len())
+	}
+	keys := make(map[queueKey]bool)
+	for app.queue.Len() > 0 {
+		item, _ := app.queue.Get()
+		keys[item.(queueKey)] = true
+		app.queue.Done(item)
+	}
+	if !keys[queueKey{Kind: kindProxyRoutes, Namespace: "default"}] || !keys[queueKey{Kind: kindServices, Namespace: "default"}] {
+		t.Fatalf("namespace keys %v", keys)
+	}
+}
+
+func TestControllerResync(t *testing.T) {
+	app, _ := newTestApp(t, newAnnotatedPod("game-0", "10.0.0.1", "game-0"))
+	app.queue = newQueue()
+	defer app.queue.ShutDown()
+	ctx := context.Background()
+
+	//routes of a pod deleted while its delete was missed
+	gone := route.NewOwner("default", route.KindPod, "game-1", "game-1")
+	if err := app.route.Replace(gone, []*route.Registration{
+		route.NewRegistration(route.NewRule(route.GET, "/api/lobby", "/lobby", 8080), "http://10.0.0.2:8080", nil),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	app.resyncAll(ctx)
+	if app.queue.Len() != 2 {
+		t.Fatalf("queued %d keys", app.queue.Len())
+	}
+	for app.queue.Len() > 0 {
+		app.processNext(ctx)
+	}
+	if app.route.Has(gone) || backendOf(app, "/api/lobby") != "" {
+		t.Fatal("routes of game-1 should be removed")
+	}
+	if backendOf(app, "/api/game") != "http://10.0.0.1:8080" {
+		t.Fatal("/api/game should proxy to game-0")
+	}
+}
+
+func TestControllerRetry(t *testing.T) {
+	game := map[string]string{"app": "game"}
+	app, _ := newTestApp(t, newTestPod("game-1", "10.0.0.1", game))
+	obj := newTestProxyRoute(route.Pod, game, route.NewRule(route.GET, "/api/game", "/game", 8080))
+	var client *dynamicFake.FakeDynamicClient
+	app.proxyRoute, client = newTestProxyRouteClient(t, obj)
+	app.queue = newQueue()
+	defer app.queue.ShutDown()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.proxyRoute.WatchEvent(ctx, proxyroute.ProxyRouteHandlerFuncs{})
+
+	//the first status update fails
+	failures := 1
+	client.PrependReactor("update", v1alpha1.ProxyRouteResource.Resource, func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "status" || failures <= 0 {
+			return false, nil, nil
+		}
+		failures--
+		return true, nil, fmt.Errorf("etcd unavailable")
+	})
+
+	key := queueKey{Kind: route.KindProxyRoute, Namespace: "default", Name: "game"}
+	app.enqueue(key.Kind, key.Namespace, key.Name)
+	app.processNext(ctx)
+	if app.queue.NumRequeues(key) != 1 {
+		t.Fatalf("failed sync requeued %d times", app.queue.NumRequeues(key))
+	}
+
+	//retried after the backoff
+	app.processNext(ctx)
+	if app.queue.NumRequeues(key) != 0 {
+		t.Fatal("retried sync should be forgotten")
+	}
+	u, err := client.Resource(v1alpha1.ProxyRouteResource).Namespace("default").Get(ctx, "game", metaV1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := v1alpha1.FromUnstructured(u)
+	if len(updated.Status.Backends) != 1 {
+		t.Fatalf("status %+v", updated.Status)
+	}
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+)
+
+//terminating pods are draining for
+const defaultDrainGrace = 30 * time.Second
+
+//terminating pods keep their routes as draining backends for grace and
+//are removed after grace. with ConsistentHash balance they only get the
+//requests of their hash keys (rooms of running matches), with other
+//balances they get no new requests. when every backend of a route is
+//draining they still take its requests
+func WithDrainGrace(grace time.Duration) Option {
+	return func(app *proxyAppImp) {
+		app.drainGrace = grace
+	}
+}
+
+//pod is routed when it is running and ready, a terminating pod that is
+//ready or was routed is draining until the grace after its deletion
+//started and then removed, a terminating pod never routed is not routed
+func podState(obj *v1.Pod, grace time.Duration, now time.Time, wasRouted bool) (routed, draining bool, remaining time.Duration) {
+	if obj.Status.Phase != v1.PodRunning || len(obj.Status.PodIP) <= 0 {
+		return false, false, 0
+	}
+
+	//terminating, the deletion timestamp is the end of the pod grace
+	if obj.DeletionTimestamp != nil {
+		if !wasRouted && !podReady(obj) {
+			return false, false, 0
+		}
+		start := obj.DeletionTimestamp.Time
+		if obj.DeletionGracePeriodSeconds != nil {
+			start = start.Add(-time.Duration(*obj.DeletionGracePeriodSeconds) * time.Second)
+		}
+		remaining = start.Add(grace).Sub(now)
+		if remaining <= 0 {
+			return false, false, 0
+		}
+		return true, true, remaining
+	}
+	return podReady(obj), false, 0
+}
+
+//pod is routed now, running and ready or draining after its deletion
+func PodRouted(obj *v1.Pod, grace time.Duration) bool {
+	routed, _, _ := podState(obj, grace, time.Now(), false)
+	return routed
+}
+
+//ready condition of pod is true
+func podReady(obj *v1.Pod) bool {
+	for _, condition := range obj.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+//queue the pod once its drain grace is over
+func (app *proxyAppImp) drainAfter(obj *v1.Pod, after time.Duration) {
+	owner := route.NewOwner(obj.Namespace, route.KindPod, obj.Name, string(obj.UID))
+
+	app.drainLock.Lock()
+	defer app.drainLock.Unlock()
+	if _, ok := app.drains[owner]; ok {
+		return
+	}
+	app.drains[owner] = time.AfterFunc(after, func() {
+		app.drainLock.Lock()
+		delete(app.drains, owner)
+		app.drainLock.Unlock()
+
+		log.Infof("pod %s drained", owner)
+		app.enqueue(route.KindPod, owner.Namespace, owner.Name)
+	})
+}
+
+//stop the drain of a deleted pod
+func (app *proxyAppImp) stopDrain(owner route.Owner) {
+	app.drainLock.Lock()
+	defer app.drainLock.Unlock()
+	if timer, ok := app.drains[owner]; ok {
+		timer.Stop()
+		delete(app.drains, owner)
+	}
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodState(t *testing.T) {
+	now := time.Now()
+	grace := 30 * time.Second
+	notReady := func(obj *v1.Pod) {
+		obj.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse}}
+	}
+	//deleted at of the pod grace, the deletion timestamp is its end
+	deleted := func(at time.Time) func(obj *v1.Pod) {
+		return func(obj *v1.Pod) {
+			seconds := int64(30)
+			end := metaV1.NewTime(at.Add(time.Duration(seconds) * time.Second))
+			obj.DeletionTimestamp = &end
+			obj.DeletionGracePeriodSeconds = &seconds
+		}
+	}
+
+	tests := []struct {
+		name      string
+		edits     []func(obj *v1.Pod)
+		wasRouted bool
+		routed    bool
+		draining  bool
+	}{
+		{
+			name:   "running and ready",
+			routed: true,
+		},
+		{
+			name:  "not ready",
+			edits: []func(obj *v1.Pod){notReady},
+		},
+		{
+			name:  "pending",
+			edits: []func(obj *v1.Pod){func(obj *v1.Pod) { obj.Status.Phase = v1.PodPending }},
+		},
+		{
+			name:     "terminating and ready",
+			edits:    []func(obj *v1.Pod){deleted(now.Add(-10 * time.Second))},
+			routed:   true,
+			draining: true,
+		},
+		{
+			name:  "terminating, not ready and never routed",
+			edits: []func(obj *v1.Pod){notReady, deleted(now.Add(-10 * time.Second))},
+		},
+		{
+			name:      "terminating, not ready and routed",
+			edits:     []func(obj *v1.Pod){notReady, deleted(now.Add(-10 * time.Second))},
+			wasRouted: true,
+			routed:    true,
+			draining:  true,
+		},
+		{
+			name:      "terminating after grace",
+			edits:     []func(obj *v1.Pod){deleted(now.Add(-40 * time.Second))},
+			wasRouted: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			obj := newTestPod("game-0", "10.0.0.1", nil)
+			for _, edit := range test.edits {
+				edit(obj)
+			}
+			routed, draining, remaining := podState(obj, grace, now, test.wasRouted)
+			if routed != test.routed || draining != test.draining {
+				t.Fatalf("routed %v draining %v", routed, draining)
+			}
+			if draining && (remaining <= 0 || remaining > grace) {
+				t.Fatalf("remaining %s", remaining)
+			}
+		})
+	}
+}
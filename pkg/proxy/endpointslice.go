@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/endpointslice"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+	discoveryV1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+//route annotated services to their ready endpoints instead of their
+//cluster ip, headless services are routed too
+func WithEndpointSlices() Option {
+	return func(app *proxyAppImp) {
+		app.endpointSlices = true
+	}
+}
+
+//watch endpoint slices, the service of a changed slice is queued
+func (app *proxyAppImp) watchEndpointSlice(ctx context.Context) {
+	app.endpointSlice.WatchEvent(ctx, endpointslice.EndpointSliceHandlerFuncs{
+		AddFunc: func(obj *discoveryV1.EndpointSlice) {
+			app.enqueueEndpointSlice(obj)
+		},
+		UpdateFunc: func(oldObj, newObj *discoveryV1.EndpointSlice) {
+			if oldObj.ResourceVersion != newObj.ResourceVersion {
+				app.enqueueEndpointSlice(newObj)
+			}
+		},
+		DeleteFunc: func(obj *discoveryV1.EndpointSlice) {
+			app.enqueueEndpointSlice(obj)
+		},
+	})
+}
+
+//queue the service of endpoint slice
+func (app *proxyAppImp) enqueueEndpointSlice(obj *discoveryV1.EndpointSlice) {
+	if name := obj.Labels[discoveryV1.LabelServiceName]; len(name) > 0 {
+		app.enqueue(route.KindService, obj.Namespace, name)
+	}
+}
+
+//queue the services of the endpoint slices referencing pod, splits of
+//their routes select endpoints by the pod labels
+func (app *proxyAppImp) enqueuePodServices(obj *v1.Pod) {
+	if app.endpointSlice == nil {
+		return
+	}
+	list, err := app.endpointSlice.Lister().EndpointSlices(obj.Namespace).List(labels.Everything())
+	if err != nil {
+		log.Errorf("list endpoint slices of pod %s/%s err %s", obj.Namespace, obj.Name, err.Error())
+		return
+	}
+	for _, slice := range list {
+		for _, endpoint := range slice.Endpoints {
+			ref := endpoint.TargetRef
+			if ref != nil && ref.Kind == "Pod" && ref.Name == obj.Name && (len(ref.Namespace) <= 0 || ref.Namespace == obj.Namespace) {
+				app.enqueueEndpointSlice(slice)
+				break
+			}
+		}
+	}
+}
+
+//ready endpoint backend of service
+type endpointBackend struct {
+	ProxyIp string
+	//labels of the pod of the endpoint, splits select endpoints by them
+	Labels map[string]string
+}
+
+//ready endpoint backends of service port in the endpoint slices of the
+//service, a port number that is not a service port is a port of the endpoints
+func (app *proxyAppImp) endpointBackends(obj *v1.Service, list []*discoveryV1.EndpointSlice, port intstr.IntOrString) ([]endpointBackend, error) {
+	number, err := ServicePort(obj, port)
+	if err != nil {
+		return nil, err
+	}
+
+	//name of the service port, endpoint slice ports are named by it
+	var name string
+	var target bool
+	for _, p := range obj.Spec.Ports {
+		if p.Port == number {
+			name, target = p.Name, true
+			break
+		}
+	}
+
+	set := make(map[string]endpointBackend)
+	for _, slice := range list {
+		if slice.AddressType == discoveryV1.AddressTypeFQDN {
+			continue
+		}
+
+		//target port of slice
+		endpointPort := number
+		if target {
+			endpointPort = 0
+			for _, p := range slice.Ports {
+				var portName string
+				if p.Name != nil {
+					portName = *p.Name
+				}
+				if p.Port != nil && portName == name {
+					endpointPort = *p.Port
+					break
+				}
+			}
+		}
+		if endpointPort <= 0 {
+			continue
+		}
+
+		//ready endpoints, an unknown condition is ready
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			endpointLabels := app.endpointLabels(slice.Namespace, endpoint)
+			for _, address := range endpoint.Addresses {
+				proxyIp := fmt.Sprintf("http://%s", net.JoinHostPort(address, fmt.Sprint(endpointPort)))
+				set[proxyIp] = endpointBackend{ProxyIp: proxyIp, Labels: endpointLabels}
+			}
+		}
+	}
+
+	backends := make([]endpointBackend, 0, len(set))
+	for _, backend := range set {
+		backends = append(backends, backend)
+	}
+	sort.Slice(backends, func(i, j int) bool {
+		return backends[i].ProxyIp < backends[j].ProxyIp
+	})
+	log.Debugf("service %s/%s port %s endpoints %v", obj.Namespace, obj.Name, port.String(), backends)
+	return backends, nil
+}
+
+//labels of the pod of endpoint from the pod cache, nil when the endpoint
+//is not a pod or the pod is not cached
+func (app *proxyAppImp) endpointLabels(namespace string, endpoint discoveryV1.Endpoint) map[string]string {
+	ref := endpoint.TargetRef
+	if ref == nil || ref.Kind != "Pod" || app.pod == nil {
+		return nil
+	}
+	if len(ref.Namespace) > 0 {
+		namespace = ref.Namespace
+	}
+	obj, err := app.pod.Lister().Pods(namespace).Get(ref.Name)
+	if err != nil {
+		return nil
+	}
+	return obj.Labels
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+	discoveryV1 "k8s.io/api/discovery/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func boolOf(b bool) *bool {
+	return &b
+}
+
+//endpoint of pod, ready nil is unknown
+func podEndpoint(pod, address string, ready *bool) discoveryV1.Endpoint {
+	return discoveryV1.Endpoint{
+		Addresses:  []string{address},
+		Conditions: discoveryV1.EndpointConditions{Ready: ready},
+		TargetRef:  &v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: pod},
+	}
+}
+
+//endpoint slice of service game
+func gameSlice(name string, addressType discoveryV1.AddressType, port string, number int32, endpoints ...discoveryV1.Endpoint) *discoveryV1.EndpointSlice {
+	return &discoveryV1.EndpointSlice{
+		ObjectMeta: metaV1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			Labels:    map[string]string{discoveryV1.LabelServiceName: "game"},
+		},
+		AddressType: addressType,
+		Ports:       []discoveryV1.EndpointPort{{Name: &port, Port: &number}},
+		Endpoints:   endpoints,
+	}
+}
+
+//headless game service, pods of track stable and canary on ipv4 and ipv6
+func newTestEndpoints(t *testing.T, annotations map[string]string) (*proxyAppImp, *v1.Service) {
+	service := newTestService("game", v1.ClusterIPNone, nil)
+	service.Annotations = annotations
+	service.Spec.Ports = []v1.ServicePort{
+		{Name: "http", Port: 80, TargetPort: intstr.FromString("http")},
+		{Name: "metrics", Port: 9100, TargetPort: intstr.FromInt(9100)},
+	}
+	app, _ := newTestEndpointApp(t,
+		service,
+		newTestPod("game-1", "10.0.0.1", map[string]string{"track": "stable"}),
+		newTestPod("game-2", "10.0.0.2", map[string]string{"track": "canary"}),
+		newTestPod("game-3", "10.0.0.3", map[string]string{"track": "stable"}),
+		gameSlice("game-v4", discoveryV1.AddressTypeIPv4, "http", 8080,
+			podEndpoint("game-1", "10.0.0.1", boolOf(true)),
+			podEndpoint("game-2", "10.0.0.2", nil),
+			podEndpoint("game-3", "10.0.0.3", boolOf(false)),
+		),
+		gameSlice("game-v6", discoveryV1.AddressTypeIPv6, "http", 8080,
+			podEndpoint("game-1", "fd00::1", boolOf(true)),
+		),
+		gameSlice("game-metrics", discoveryV1.AddressTypeIPv4, "metrics", 9100,
+			podEndpoint("game-1", "10.0.0.1", boolOf(true)),
+		),
+		gameSlice("game-fqdn", discoveryV1.AddressTypeFQDN, "http", 8080,
+			discoveryV1.Endpoint{Addresses: []string{"game.example.com"}},
+		),
+	)
+	return app, service
+}
+
+func TestEndpointBackends(t *testing.T) {
+	app, service := newTestEndpoints(t, nil)
+	slices, err := app.endpointSlice.Lister().EndpointSlices("default").List(labels.Everything())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stable := map[string]string{"track": "stable"}
+	canary := map[string]string{"track": "canary"}
+
+	tests := []struct {
+		name     string
+		port     intstr.IntOrString
+		backends []endpointBackend
+		err      string
+	}{
+		{
+			name: "named port, ready endpoints of both families with pod labels",
+			port: intstr.FromString("http"),
+			backends: []endpointBackend{
+				{ProxyIp: "http://10.0.0.1:8080", Labels: stable},
+				{ProxyIp: "http://10.0.0.2:8080", Labels: canary},
+				{ProxyIp: "http://[fd00::1]:8080", Labels: stable},
+			},
+		},
+		{
+			name: "service port number",
+			port: intstr.FromInt(80),
+			backends: []endpointBackend{
+				{ProxyIp: "http://10.0.0.1:8080", Labels: stable},
+				{ProxyIp: "http://10.0.0.2:8080", Labels: canary},
+				{ProxyIp: "http://[fd00::1]:8080", Labels: stable},
+			},
+		},
+		{
+			name: "other named port",
+			port: intstr.FromString("metrics"),
+			backends: []endpointBackend{
+				{ProxyIp: "http://10.0.0.1:9100", Labels: stable},
+			},
+		},
+		{
+			name: "endpoint port number of every slice",
+			port: intstr.FromInt(7000),
+			backends: []endpointBackend{
+				{ProxyIp: "http://10.0.0.1:7000", Labels: stable},
+				{ProxyIp: "http://10.0.0.2:7000", Labels: canary},
+				{ProxyIp: "http://[fd00::1]:7000", Labels: stable},
+			},
+		},
+		{
+			name: "unknown named port",
+			port: intstr.FromString("grpc"),
+			err:  "grpc",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backends, err := app.endpointBackends(service, slices, test.port)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(backends, test.backends) {
+				t.Fatalf("backends %v", backends)
+			}
+		})
+	}
+}
+
+func TestEndpointSplit(t *testing.T) {
+	app, service := newTestEndpoints(t, map[string]string{
+		AnnotationProxyV2: "ProxyPattern: Service\nItems:\n- Method: GET\n  AgentUrl: /api/game\n  ProxyUrl: /game\n  Port: http\n  Split:\n  - Labels: {track: canary}\n    Weight: 50\n",
+	})
+	app.AddServiceRoute(service)
+
+	//canary pod gets the split of its labels
+	hits := 0
+	for i := 0; i < 2000; i++ {
+		result, ok := app.route.Lookup(httptest.NewRequest("GET", "http://games.example.com/api/game", nil))
+		if !ok {
+			t.Fatal("/api/game not found")
+		}
+		if result.Backend.ProxyIp == "http://10.0.0.2:8080" {
+			hits++
+		}
+	}
+	if hits < 800 || hits > 1200 {
+		t.Fatalf("canary got %d of 2000", hits)
+	}
+}
+
+func TestEnqueuePodServices(t *testing.T) {
+	app, _ := newTestEndpoints(t, nil)
+	app.queue = newQueue()
+	defer app.queue.ShutDown()
+
+	//service of the slices referencing the pod is queued once
+	app.enqueuePodServices(newTestPod("game-1", "10.0.0.1", map[string]string{"track": "canary"}))
+	if app.queue.Len() != 1 {
+		t.Fatalf("queued %d keys", app.queue.Len())
+	}
+	item, _ := app.queue.Get()
+	if key := item.(queueKey); key != (queueKey{Kind: route.KindService, Namespace: "default", Name: "game"}) {
+		t.Fatalf("queued %v", key)
+	}
+	app.queue.Done(item)
+
+	//pod of no endpoint
+	app.enqueuePodServices(newTestPod("lobby-1", "10.0.1.1", nil))
+	if app.queue.Len() != 0 {
+		t.Fatalf("queued %d keys", app.queue.Len())
+	}
+}
@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/event"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	coreV1 "k8s.io/api/core/v1"
+	eventsV1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	//event reporting controller
+	eventController = "kubegames.io/kubegames-proxy"
+	//event action
+	eventAction = "Route"
+	//same event is not recorded again within
+	eventTTL = time.Hour
+	//events waiting to be created
+	eventBuffer = 256
+	//timeout of creating an event
+	eventTimeout = 5 * time.Second
+
+	//event reasons
+	ReasonInvalidAnnotation  = "InvalidProxyAnnotation"
+	ReasonPatternMismatch    = "ProxyPatternMismatch"
+	ReasonRejectedRule       = "RejectedProxyRule"
+	ReasonUnresolvedPort     = "UnresolvedProxyPort"
+	ReasonConflictingRoute   = "ConflictingProxyRoute"
+	ReasonRegistered         = "ProxyRoutesRegistered"
+	ReasonInvalidProxyRoute  = "InvalidProxyRoute"
+	ReasonInvalidStaticRoute = "InvalidStaticRoute"
+	ReasonDraining           = "ProxyRoutesDraining"
+)
+
+type (
+	//event recorder, every proxy replica sees the same objects so
+	//events are named by content and replicas do not record them twice.
+	//events are created in the background, a full buffer drops them
+	recorder struct {
+		event    event.Event
+		instance string
+		recorded map[string]time.Time
+		events   chan *eventsV1.Event
+		lock     sync.Mutex
+	}
+)
+
+//new recorder
+func newRecorder(e event.Event) *recorder {
+	instance, _ := os.Hostname()
+	return &recorder{
+		event:    e,
+		instance: instance,
+		recorded: make(map[string]time.Time),
+		events:   make(chan *eventsV1.Event, eventBuffer),
+	}
+}
+
+//warning event
+func (r *recorder) Warningf(regarding coreV1.ObjectReference, reason, format string, args ...interface{}) {
+	r.record(regarding, coreV1.EventTypeWarning, reason, fmt.Sprintf(format, args...))
+}
+
+//normal event
+func (r *recorder) Normalf(regarding coreV1.ObjectReference, reason, format string, args ...interface{}) {
+	r.record(regarding, coreV1.EventTypeNormal, reason, fmt.Sprintf(format, args...))
+}
+
+//queue event, an event reported again within ttl of its last report
+//is skipped, so resyncs do not record the same event again
+func (r *recorder) record(regarding coreV1.ObjectReference, eventType, reason, note string) {
+	if r == nil || r.event == nil {
+		return
+	}
+
+	//name by content
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s %s %s %s", regarding.UID, eventType, reason, note)
+	name := fmt.Sprintf("%s.%x", regarding.Name, h.Sum64())
+
+	//skip recorded
+	r.lock.Lock()
+	now := time.Now()
+	at, ok := r.recorded[name]
+	r.recorded[name] = now
+	r.lock.Unlock()
+	if ok && now.Sub(at) <= eventTTL {
+		return
+	}
+
+	//note is limited to 1kB
+	if len(note) > 1024 {
+		note = note[:1021] + "..."
+	}
+
+	e := &eventsV1.Event{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      name,
+			Namespace: regarding.Namespace,
+		},
+		EventTime:           metaV1.NewMicroTime(now),
+		ReportingController: eventController,
+		ReportingInstance:   r.instance,
+		Action:              eventAction,
+		Reason:              reason,
+		Regarding:           regarding,
+		Note:                note,
+		Type:                eventType,
+	}
+	select {
+	case r.events <- e:
+	default:
+		//not recorded, report it again next time
+		r.forget(name)
+		log.Warnf("drop event %s %s, buffer full", regarding.Name, reason)
+	}
+}
+
+//forget recorded event
+func (r *recorder) forget(name string) {
+	r.lock.Lock()
+	delete(r.recorded, name)
+	r.lock.Unlock()
+}
+
+//create queued events until ctx is done, events not reported
+//within ttl are pruned
+func (r *recorder) run(ctx context.Context) {
+	ticker := time.NewTicker(eventTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-r.events:
+			r.create(ctx, e)
+		case now := <-ticker.C:
+			r.lock.Lock()
+			for name, at := range r.recorded {
+				if now.Sub(at) > eventTTL {
+					delete(r.recorded, name)
+				}
+			}
+			r.lock.Unlock()
+		}
+	}
+}
+
+//create event with timeout
+func (r *recorder) create(ctx context.Context, e *eventsV1.Event) {
+	ctx, cancel := context.WithTimeout(ctx, eventTimeout)
+	defer cancel()
+	err := r.event.Create(ctx, e.Namespace, e)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		//failed event is recorded again next time
+		r.forget(e.Name)
+		log.Errorf("record event %s %s err %s", e.Regarding.Name, e.Reason, err.Error())
+	}
+}
+
+//pod reference
+func podReference(obj *coreV1.Pod) coreV1.ObjectReference {
+	return coreV1.ObjectReference{
+		APIVersion:      "v1",
+		Kind:            "Pod",
+		Namespace:       obj.Namespace,
+		Name:            obj.Name,
+		UID:             obj.UID,
+		ResourceVersion: obj.ResourceVersion,
+	}
+}
+
+//service reference
+func serviceReference(obj *coreV1.Service) coreV1.ObjectReference {
+	return coreV1.ObjectReference{
+		APIVersion:      "v1",
+		Kind:            "Service",
+		Namespace:       obj.Namespace,
+		Name:            obj.Name,
+		UID:             obj.UID,
+		ResourceVersion: obj.ResourceVersion,
+	}
+}
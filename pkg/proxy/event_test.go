@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/event"
+	coreV1 "k8s.io/api/core/v1"
+	eventsV1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+//events created in memory, create fails while err is set
+type fakeEvent struct {
+	created []*eventsV1.Event
+	err     error
+	lock    sync.Mutex
+}
+
+func (f *fakeEvent) Create(ctx context.Context, namespace string, e *eventsV1.Event) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.created = append(f.created, e)
+	return nil
+}
+
+func (f *fakeEvent) Delete(ctx context.Context, namespace string, name string) error {
+	return nil
+}
+
+func (f *fakeEvent) List(ctx context.Context, namespace string, fieldselector fields.Selector) ([]*eventsV1.Event, error) {
+	return nil, nil
+}
+
+func (f *fakeEvent) Get(ctx context.Context, namespace string, name string) (*eventsV1.Event, error) {
+	return nil, fmt.Errorf("not found")
+}
+
+func (f *fakeEvent) WatchEvent(ctx context.Context, handler event.EventHandlerFuncs) {}
+
+func (f *fakeEvent) count() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.created)
+}
+
+//drain queued events
+func flush(r *recorder) {
+	for {
+		select {
+		case e := <-r.events:
+			r.create(context.Background(), e)
+		default:
+			return
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	fake := &fakeEvent{}
+	r := newRecorder(fake)
+	ref := coreV1.ObjectReference{Namespace: "default", Name: "game-1", UID: "1"}
+
+	//same warning of every resync is recorded once
+	for i := 0; i < 3; i++ {
+		r.Warningf(ref, ReasonConflictingRoute, "%s conflicts", "/api/game")
+	}
+	flush(r)
+	if fake.count() != 1 {
+		t.Fatalf("recorded %d events", fake.count())
+	}
+	if e := fake.created[0]; e.Type != coreV1.EventTypeWarning || e.Reason != ReasonConflictingRoute || e.Note != "/api/game conflicts" {
+		t.Fatalf("event %v", e)
+	}
+
+	//another note is another event
+	r.Warningf(ref, ReasonConflictingRoute, "%s conflicts", "/api/room")
+	flush(r)
+	if fake.count() != 2 {
+		t.Fatalf("recorded %d events", fake.count())
+	}
+
+	//failed event is recorded again
+	fake.err = fmt.Errorf("unavailable")
+	r.Normalf(ref, ReasonRegistered, "registered")
+	flush(r)
+	fake.err = nil
+	r.Normalf(ref, ReasonRegistered, "registered")
+	flush(r)
+	if fake.count() != 3 {
+		t.Fatalf("recorded %d events", fake.count())
+	}
+
+	//full buffer drops events without blocking
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < eventBuffer+10; i++ {
+			r.Normalf(ref, ReasonRegistered, "registered %d", i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("recorder blocked on full buffer")
+	}
+	if len(r.events) != eventBuffer {
+		t.Fatalf("queued %d events", len(r.events))
+	}
+}
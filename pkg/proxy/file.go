@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+)
+
+//file changes are loaded once they settle for
+const fileReloadDelay = 200 * time.Millisecond
+
+//route static rules of a file or of the .yaml, .yml and .json files of
+//a directory, files are reloaded when they change and the routes of a
+//file are owned by the file
+func WithFileRoutes(path string) Option {
+	return func(app *proxyAppImp) {
+		app.file = filepath.Clean(path)
+	}
+}
+
+//load file routes and watch the file or directory
+func (app *proxyAppImp) watchFileRoutes(ctx context.Context) {
+	app.loadFileRoutes()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Errorf("watch file routes %s err %s", app.file, err.Error())
+		return
+	}
+
+	//a file is replaced by renames of editors, watch its directory
+	dir := app.file
+	if info, err := os.Stat(app.file); err != nil || !info.IsDir() {
+		dir = filepath.Dir(app.file)
+	}
+	if err := watcher.Add(dir); err != nil {
+		log.Errorf("watch file routes %s err %s", dir, err.Error())
+		watcher.Close()
+		return
+	}
+
+	go func() {
+		defer watcher.Close()
+		var reload <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if dir != app.file && filepath.Clean(event.Name) != app.file {
+					continue
+				}
+				reload = time.After(fileReloadDelay)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Errorf("watch file routes %s err %s", dir, err.Error())
+			case <-reload:
+				reload = nil
+				app.loadFileRoutes()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+//route rules of every file, a file with invalid rules keeps its last
+//routes and routes of removed files are deleted
+func (app *proxyAppImp) loadFileRoutes() {
+	files, err := routeFiles(app.file)
+	if err != nil {
+		log.Errorf("file routes %s err %s", app.file, err.Error())
+		return
+	}
+
+	owners := make(map[route.Owner]bool, len(files))
+	for _, file := range files {
+		owner := route.NewOwner("", route.KindFile, file, "")
+		owners[owner] = true
+
+		buff, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Errorf("file routes %s err %s", file, err.Error())
+			continue
+		}
+		rules, err := route.ParseStatic(buff)
+		if err != nil {
+			//keep the routes of the last valid rules
+			log.Errorf("file routes %s err %s", file, err.Error())
+			continue
+		}
+		if err := app.route.Replace(owner, rules.Registrations()); err != nil {
+			log.Errorf("replace route %s err %s", owner, err.Error())
+		}
+		for _, conflict := range app.route.Conflicts(owner) {
+			log.Warnf("route %s %s", owner, conflict)
+		}
+		log.Infof("load %d file routes of %s", len(rules.Items), file)
+	}
+
+	//removed files
+	for _, owner := range app.route.Owners() {
+		if owner.Kind == route.KindFile && !owners[owner] {
+			app.route.Delete(owner)
+		}
+	}
+}
+
+//route files of path, a missing file has no routes
+func routeFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, info := range infos {
+		switch strings.ToLower(filepath.Ext(info.Name())) {
+		case ".yaml", ".yml", ".json":
+			if !info.IsDir() {
+				files = append(files, filepath.Join(path, info.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+)
+
+//static rules of agent url to backend
+func fileRules(agentUrl, backend string) string {
+	return fmt.Sprintf("Items:\n- Method: GET\n  AgentUrl: %s\n  ProxyUrl: %s\n  Backends: [%s]\n", agentUrl, agentUrl, backend)
+}
+
+func writeFile(t *testing.T, path, data string) {
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//backend of path, empty when not routed
+func backendOf(app *proxyAppImp, path string) string {
+	result, ok := app.route.Lookup(httptest.NewRequest("GET", "http://localhost"+path, nil))
+	if !ok {
+		return ""
+	}
+	return result.Backend.ProxyIp
+}
+
+func TestLoadFileRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	docs := filepath.Join(dir, "docs.yaml")
+	game := filepath.Join(dir, "game.json")
+	writeFile(t, docs, fileRules("/docs", "http://10.0.0.1:8080"))
+	writeFile(t, game, `{"Items": [{"Method": "GET", "AgentUrl": "/game", "ProxyUrl": "/game", "Backends": ["http://10.0.0.2:8080"]}]}`)
+	writeFile(t, filepath.Join(dir, "README.md"), fileRules("/readme", "http://10.0.0.3:8080"))
+
+	app := &proxyAppImp{route: route.NewRoute(), file: dir}
+	app.loadFileRoutes()
+	if backendOf(app, "/docs") != "http://10.0.0.1:8080" || backendOf(app, "/game") != "http://10.0.0.2:8080" {
+		t.Fatal("routes of every yaml and json file should be loaded")
+	}
+	if len(backendOf(app, "/readme")) > 0 {
+		t.Fatal("other files should not be loaded")
+	}
+
+	//invalid file keeps its last routes
+	writeFile(t, docs, "Items:\n- Method: GET\n  AgentUrl: docs\n")
+	app.loadFileRoutes()
+	if backendOf(app, "/docs") != "http://10.0.0.1:8080" {
+		t.Fatal("routes of the last valid file should be kept")
+	}
+
+	//routes of a deleted file are removed
+	if err := os.Remove(game); err != nil {
+		t.Fatal(err)
+	}
+	app.loadFileRoutes()
+	if len(backendOf(app, "/game")) > 0 {
+		t.Fatal("routes of a deleted file should be removed")
+	}
+	if backendOf(app, "/docs") != "http://10.0.0.1:8080" {
+		t.Fatal("routes of other files should be kept")
+	}
+}
+
+func TestWatchFileRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "routes.yaml")
+	writeFile(t, file, fileRules("/docs", "http://10.0.0.1:8080"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app := &proxyAppImp{route: route.NewRoute(), file: file}
+	app.watchFileRoutes(ctx)
+	if backendOf(app, "/docs") != "http://10.0.0.1:8080" {
+		t.Fatal("routes should be loaded at start")
+	}
+
+	//wait until path is routed to backend
+	wait := func(path, backend string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for backendOf(app, path) != backend {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s routed to %q, expected %q", path, backendOf(app, path), backend)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	//reload on change
+	writeFile(t, file, fileRules("/docs", "http://10.0.0.2:8080"))
+	wait("/docs", "http://10.0.0.2:8080")
+
+	//replaced by rename like editors do
+	next := filepath.Join(dir, "routes.yaml.tmp")
+	writeFile(t, next, fileRules("/game", "http://10.0.0.3:8080"))
+	if err := os.Rename(next, file); err != nil {
+		t.Fatal(err)
+	}
+	wait("/game", "http://10.0.0.3:8080")
+	wait("/docs", "")
+
+	//deleted file
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	wait("/game", "")
+}
@@ -0,0 +1,455 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/gateway"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/httproute"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	gatewayV1 "github.com/kubegames/kubegames-proxy/pkg/apis/gateway"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+)
+
+const (
+	//gateway api controller name of proxy
+	gatewayControllerName = "kubegames.io/kubegames-proxy"
+	//backend ref label (name:port) of http route backends, weights
+	//are split by it
+	labelBackendRef = "kubegames.io/backend-ref"
+)
+
+//route HTTPRoute objects attached to gateways of gateway class,
+//the gateway api crds must be installed
+func WithGateway(client dynamic.Interface, class string) Option {
+	return func(app *proxyAppImp) {
+		factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+		app.gatewayClass = class
+		app.gateway = gateway.NewGateway(client, factory)
+		app.httpRoute = httproute.NewHTTPRoute(client, factory)
+	}
+}
+
+//watch gateways and http routes, changed http routes are queued and
+//reconciled by the controller
+func (app *proxyAppImp) watchHTTPRoute(ctx context.Context) {
+	//gateway class changes attach or detach routes
+	app.gateway.WatchEvent(ctx, gateway.GatewayHandlerFuncs{
+		AddFunc: func(obj *gatewayV1.Gateway) {
+			app.enqueueNamespace(kindHTTPRoutes, "")
+		},
+		UpdateFunc: func(oldObj, newObj *gatewayV1.Gateway) {
+			if oldObj.Spec.GatewayClassName != newObj.Spec.GatewayClassName {
+				app.enqueueNamespace(kindHTTPRoutes, "")
+			}
+		},
+		DeleteFunc: func(obj *gatewayV1.Gateway) {
+			app.enqueueNamespace(kindHTTPRoutes, "")
+		},
+	})
+
+	app.httpRoute.WatchEvent(ctx, httproute.HTTPRouteHandlerFuncs{
+		AddFunc: func(obj *gatewayV1.HTTPRoute) {
+			app.enqueue(route.KindHTTPRoute, obj.Namespace, obj.Name)
+		},
+		UpdateFunc: func(oldObj, newObj *gatewayV1.HTTPRoute) {
+			if oldObj.ResourceVersion != newObj.ResourceVersion {
+				app.enqueue(route.KindHTTPRoute, newObj.Namespace, newObj.Name)
+			}
+		},
+		DeleteFunc: func(obj *gatewayV1.HTTPRoute) {
+			app.enqueue(route.KindHTTPRoute, obj.Namespace, obj.Name)
+		},
+	})
+}
+
+//route rules of http route attached to a gateway of proxy, a failed
+//status update is returned
+func (app *proxyAppImp) AddHTTPRoute(ctx context.Context, obj *gatewayV1.HTTPRoute) error {
+	owner := route.NewOwner(obj.Namespace, route.KindHTTPRoute, obj.Name, string(obj.UID))
+	ref := httpRouteReference(obj)
+
+	//not attached
+	parents := app.httpRouteParents(ctx, obj)
+	if len(parents) <= 0 {
+		app.route.Delete(owner)
+		return app.updateHTTPRouteStatus(ctx, obj, nil, nil)
+	}
+
+	registrations, errs := app.httpRouteRegistrations(ctx, obj)
+	if err := app.route.Replace(owner, registrations); err != nil {
+		errs = append(errs, err)
+	}
+	for _, err := range errs {
+		log.Errorf("http route %s err %s", owner, err.Error())
+		app.recorder.Warningf(ref, ReasonRejectedRule, "%s", err.Error())
+	}
+	for _, conflict := range app.route.Conflicts(owner) {
+		log.Warnf("route %s %s", owner, conflict)
+		app.recorder.Warningf(ref, ReasonConflictingRoute, "%s", conflict)
+	}
+	return app.updateHTTPRouteStatus(ctx, obj, parents, errs)
+}
+
+//parents of http route that are gateways of gateway class
+func (app *proxyAppImp) httpRouteParents(ctx context.Context, obj *gatewayV1.HTTPRoute) (parents []gatewayV1.ParentReference) {
+	for _, parent := range obj.Spec.ParentRefs {
+		if parent.Group != nil && *parent.Group != gatewayV1.Group {
+			continue
+		}
+		if parent.Kind != nil && *parent.Kind != gatewayV1.KindGateway {
+			continue
+		}
+		namespace := obj.Namespace
+		if parent.Namespace != nil {
+			namespace = *parent.Namespace
+		}
+		g, err := app.gateway.Get(ctx, namespace, parent.Name)
+		if err != nil || g.Spec.GatewayClassName != app.gatewayClass {
+			continue
+		}
+		parents = append(parents, parent)
+	}
+	return parents
+}
+
+//registrations of http route rules, a rule is registered for every
+//match and hostname, and for every backend ref of the rule
+func (app *proxyAppImp) httpRouteRegistrations(ctx context.Context, obj *gatewayV1.HTTPRoute) (registrations []*route.Registration, errs []error) {
+	hosts := obj.Spec.Hostnames
+	if len(hosts) <= 0 {
+		hosts = []string{route.DefaultHost}
+	}
+
+	for index, rule := range obj.Spec.Rules {
+		//backends
+		var backends []httpRouteBackend
+		var weights []int32
+		refs := make(map[string]bool, len(rule.BackendRefs))
+		for _, backendRef := range rule.BackendRefs {
+			backend, err := app.httpRouteBackend(ctx, obj.Namespace, backendRef.BackendObjectReference)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rule %d %s", index, err.Error()))
+				continue
+			}
+			//weights are split by the backend ref label
+			if refs[backend.Labels[labelBackendRef]] {
+				errs = append(errs, fmt.Errorf("rule %d backend %s is referenced twice", index, backend.Labels[labelBackendRef]))
+				continue
+			}
+			refs[backend.Labels[labelBackendRef]] = true
+			//a backend of weight 0 takes no requests
+			weight := int32(1)
+			if backendRef.Weight != nil {
+				weight = *backendRef.Weight
+			}
+			if weight < 0 {
+				errs = append(errs, fmt.Errorf("rule %d backend %s weight %d is negative", index, backendRef.Name, weight))
+				continue
+			}
+			if weight == 0 {
+				continue
+			}
+			backends = append(backends, backend)
+			weights = append(weights, weight)
+		}
+		splits := httpRouteSplits(backends, weights)
+
+		//mirror backends
+		var mirrors []httpRouteBackend
+		var mirror *route.Mirror
+		for _, filter := range rule.Filters {
+			if filter.Type != gatewayV1.FilterRequestMirror || filter.RequestMirror == nil {
+				continue
+			}
+			backend, err := app.httpRouteBackend(ctx, obj.Namespace, filter.RequestMirror.BackendRef)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rule %d mirror %s", index, err.Error()))
+				continue
+			}
+			mirror = &route.Mirror{Percent: 100}
+			if filter.RequestMirror.Percent != nil {
+				mirror.Percent = int64(*filter.RequestMirror.Percent)
+			}
+			mirrors = append(mirrors, backend)
+		}
+
+		matches := rule.Matches
+		if len(matches) <= 0 {
+			matches = []gatewayV1.HTTPRouteMatch{{}}
+		}
+		for _, match := range matches {
+			for _, host := range hosts {
+				r, err := httpRouteRule(host, match, rule.Filters)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("rule %d %s", index, err.Error()))
+					break
+				}
+				r.Split = splits
+				for _, backend := range backends {
+					registrations = append(registrations, route.NewRegistration(r, backend.ProxyIp, backend.Labels))
+				}
+				for _, backend := range mirrors {
+					m := *r
+					m.Split = nil
+					m.Mirror = mirror
+					registrations = append(registrations, route.NewRegistration(&m, backend.ProxyIp, backend.Labels))
+				}
+			}
+		}
+	}
+	return registrations, errs
+}
+
+//resolved backend ref
+type httpRouteBackend struct {
+	ProxyIp string
+	Labels  map[string]string
+}
+
+//service backend of backend ref, references to other namespaces are not granted
+func (app *proxyAppImp) httpRouteBackend(ctx context.Context, namespace string, ref gatewayV1.BackendObjectReference) (httpRouteBackend, error) {
+	if (ref.Group != nil && len(*ref.Group) > 0) || (ref.Kind != nil && *ref.Kind != gatewayV1.KindService) {
+		return httpRouteBackend{}, fmt.Errorf("backend %s kind not supported", ref.Name)
+	}
+	if ref.Namespace != nil && *ref.Namespace != namespace {
+		return httpRouteBackend{}, fmt.Errorf("backend %s/%s in another namespace", *ref.Namespace, ref.Name)
+	}
+	if ref.Port == nil {
+		return httpRouteBackend{}, fmt.Errorf("backend %s port is empty", ref.Name)
+	}
+	proxyIp, _, err := app.serviceBackend(ctx, namespace, ref.Name, intstr.FromInt(int(*ref.Port)))
+	if err != nil {
+		return httpRouteBackend{}, err
+	}
+	return httpRouteBackend{ProxyIp: proxyIp, Labels: map[string]string{labelBackendRef: fmt.Sprintf("%s:%d", ref.Name, *ref.Port)}}, nil
+}
+
+//rule of http route match, the request path is proxied unchanged
+//unless a url rewrite filter is set
+func httpRouteRule(host string, match gatewayV1.HTTPRouteMatch, filters []gatewayV1.HTTPRouteFilter) (*route.Rule, error) {
+	r := &route.Rule{
+		Method:  route.Any,
+		Host:    host,
+		Rewrite: new(route.Rewrite),
+	}
+
+	//method
+	if match.Method != nil {
+		r.Method = route.Method(*match.Method)
+	}
+
+	//path
+	pathType, path := gatewayV1.PathMatchPathPrefix, "/"
+	if match.Path != nil {
+		if match.Path.Type != nil {
+			pathType = *match.Path.Type
+		}
+		if match.Path.Value != nil {
+			path = *match.Path.Value
+		}
+	}
+	switch pathType {
+	case gatewayV1.PathMatchPathPrefix:
+		r.AgentUrl = path
+	case gatewayV1.PathMatchExact:
+		r.Match = route.Regex
+		r.AgentUrl = "^" + regexp.QuoteMeta(path) + "$"
+	case gatewayV1.PathMatchRegularExpression:
+		r.Match = route.Regex
+		r.AgentUrl = "^" + strings.TrimPrefix(path, "^")
+	default:
+		return nil, fmt.Errorf("path match %s not supported", pathType)
+	}
+
+	//headers and query
+	for _, header := range match.Headers {
+		if header.Type != nil && *header.Type != gatewayV1.MatchExact {
+			return nil, fmt.Errorf("header match %s not supported", *header.Type)
+		}
+		r.Headers = append(r.Headers, route.NewCondition(header.Name, route.Equal, header.Value))
+	}
+	for _, query := range match.QueryParams {
+		if query.Type != nil && *query.Type != gatewayV1.MatchExact {
+			return nil, fmt.Errorf("query match %s not supported", *query.Type)
+		}
+		r.Query = append(r.Query, route.NewCondition(query.Name, route.Equal, query.Value))
+	}
+
+	//filters
+	for _, filter := range filters {
+		switch filter.Type {
+		case gatewayV1.FilterRequestMirror:
+		case gatewayV1.FilterURLRewrite:
+			if filter.URLRewrite == nil {
+				continue
+			}
+			if filter.URLRewrite.Hostname != nil {
+				return nil, fmt.Errorf("hostname rewrite not supported")
+			}
+			modifier := filter.URLRewrite.Path
+			if modifier == nil {
+				continue
+			}
+			switch {
+			case modifier.Type == gatewayV1.FullPathHTTPPathModifier && modifier.ReplaceFullPath != nil:
+				r.Rewrite.Template = *modifier.ReplaceFullPath
+			case modifier.Type == gatewayV1.PrefixMatchHTTPPathModifier && modifier.ReplacePrefixMatch != nil && pathType == gatewayV1.PathMatchPathPrefix:
+				r.Rewrite.StripPrefix = path
+				r.Rewrite.AddPrefix = *modifier.ReplacePrefixMatch
+			default:
+				return nil, fmt.Errorf("path rewrite %s not supported", modifier.Type)
+			}
+		default:
+			return nil, fmt.Errorf("filter %s not supported", filter.Type)
+		}
+	}
+	return r, r.ValidateResolved()
+}
+
+//splits of backend weights, nil when every backend has the same weight,
+//backends without a positive weight are dropped
+func httpRouteSplits(backends []httpRouteBackend, weights []int32) []*route.Split {
+	var positive []httpRouteBackend
+	var positiveWeights []int32
+	for index, weight := range weights {
+		if weight > 0 {
+			positive = append(positive, backends[index])
+			positiveWeights = append(positiveWeights, weight)
+		}
+	}
+	backends, weights = positive, positiveWeights
+	if len(backends) <= 1 {
+		return nil
+	}
+	var total int64
+	same := true
+	for _, weight := range weights {
+		total += int64(weight)
+		same = same && weight == weights[0]
+	}
+	if same {
+		return nil
+	}
+
+	//percents, the rounding rest goes to the first backends
+	splits := make([]*route.Split, len(backends))
+	var sum int64
+	for index, backend := range backends {
+		percent := int64(weights[index]) * 100 / total
+		splits[index] = &route.Split{Labels: backend.Labels, Weight: percent}
+		sum += percent
+	}
+	for index := 0; sum < 100; index = (index + 1) % len(splits) {
+		splits[index].Weight++
+		sum++
+	}
+	return splits
+}
+
+//update parents of proxy in http route status when they changed,
+//parents of other controllers are kept. a write of a stale object
+//conflicts and is skipped like proxy route status writes
+func (app *proxyAppImp) updateHTTPRouteStatus(ctx context.Context, obj *gatewayV1.HTTPRoute, parents []gatewayV1.ParentReference, errs []error) error {
+	var statuses []gatewayV1.RouteParentStatus
+	existing := make(map[string]gatewayV1.RouteParentStatus)
+	for _, status := range obj.Status.Parents {
+		if status.ControllerName != gatewayControllerName {
+			statuses = append(statuses, status)
+			continue
+		}
+		existing[parentKey(status.ParentRef)] = status
+	}
+
+	resolved := metaV1.Condition{
+		Type:               "ResolvedRefs",
+		Status:             metaV1.ConditionTrue,
+		ObservedGeneration: obj.Generation,
+		Reason:             "ResolvedRefs",
+	}
+	if len(errs) > 0 {
+		messages := make([]string, len(errs))
+		for index, err := range errs {
+			messages[index] = err.Error()
+		}
+		resolved.Status = metaV1.ConditionFalse
+		resolved.Reason = "BackendNotFound"
+		resolved.Message = strings.Join(messages, "; ")
+	}
+	for _, parent := range parents {
+		status := existing[parentKey(parent)]
+		status.ParentRef = parent
+		status.ControllerName = gatewayControllerName
+		meta.SetStatusCondition(&status.Conditions, metaV1.Condition{
+			Type:               "Accepted",
+			Status:             metaV1.ConditionTrue,
+			ObservedGeneration: obj.Generation,
+			Reason:             "Accepted",
+		})
+		meta.SetStatusCondition(&status.Conditions, resolved)
+		statuses = append(statuses, status)
+	}
+
+	if reflect.DeepEqual(obj.Status.Parents, statuses) || (len(obj.Status.Parents) <= 0 && len(statuses) <= 0) {
+		return nil
+	}
+	obj.Status.Parents = statuses
+	err := app.httpRoute.UpdateStatus(ctx, obj)
+	if errors.IsConflict(err) {
+		log.Debugf("update http route %s/%s status conflict", obj.Namespace, obj.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("update http route %s/%s status %s", obj.Namespace, obj.Name, err.Error())
+	}
+	return nil
+}
+
+//key of parent reference
+func parentKey(parent gatewayV1.ParentReference) string {
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	return fmt.Sprintf("%s/%s/%s/%s/%s", value(parent.Group), value(parent.Kind), value(parent.Namespace), parent.Name, value(parent.SectionName))
+}
+
+//queue http routes of namespace after services or gateways changed
+func (app *proxyAppImp) enqueueHTTPRoutes(ctx context.Context, namespace string) error {
+	if app.httpRoute == nil {
+		return nil
+	}
+	list, err := app.httpRoute.List(ctx, namespace, labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, obj := range list {
+		app.enqueue(route.KindHTTPRoute, obj.Namespace, obj.Name)
+	}
+	return nil
+}
+
+//http route reference
+func httpRouteReference(obj *gatewayV1.HTTPRoute) v1.ObjectReference {
+	return v1.ObjectReference{
+		APIVersion:      gatewayV1.Group + "/" + gatewayV1.Version,
+		Kind:            gatewayV1.KindHTTPRoute,
+		Namespace:       obj.Namespace,
+		Name:            obj.Name,
+		UID:             obj.UID,
+		ResourceVersion: obj.ResourceVersion,
+	}
+}
@@ -0,0 +1,333 @@
+package proxy
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/gateway"
+	gatewayV1 "github.com/kubegames/kubegames-proxy/pkg/apis/gateway"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+)
+
+func stringOf(s string) *string {
+	return &s
+}
+
+func int32Of(i int32) *int32 {
+	return &i
+}
+
+func TestHTTPRouteRule(t *testing.T) {
+	tests := []struct {
+		name     string
+		match    gatewayV1.HTTPRouteMatch
+		filters  []gatewayV1.HTTPRouteFilter
+		method   route.Method
+		pattern  route.Match
+		agentUrl string
+		rewrite  route.Rewrite
+		headers  int
+		query    int
+		err      string
+	}{
+		{
+			name:     "default prefix",
+			method:   route.Any,
+			agentUrl: "/",
+		},
+		{
+			name:     "prefix and method",
+			match:    gatewayV1.HTTPRouteMatch{Path: &gatewayV1.HTTPPathMatch{Value: stringOf("/api/game")}, Method: stringOf("POST")},
+			method:   route.POST,
+			agentUrl: "/api/game",
+		},
+		{
+			name:     "exact",
+			match:    gatewayV1.HTTPRouteMatch{Path: &gatewayV1.HTTPPathMatch{Type: stringOf(gatewayV1.PathMatchExact), Value: stringOf("/api/game.json")}},
+			method:   route.Any,
+			pattern:  route.Regex,
+			agentUrl: `^/api/game\.json$`,
+		},
+		{
+			name:     "regular expression",
+			match:    gatewayV1.HTTPRouteMatch{Path: &gatewayV1.HTTPPathMatch{Type: stringOf(gatewayV1.PathMatchRegularExpression), Value: stringOf("^/api/room/[0-9]+")}},
+			method:   route.Any,
+			pattern:  route.Regex,
+			agentUrl: "^/api/room/[0-9]+",
+		},
+		{
+			name: "exact headers and query",
+			match: gatewayV1.HTTPRouteMatch{
+				Headers:     []gatewayV1.HTTPHeaderMatch{{Name: "x-version", Value: "2"}},
+				QueryParams: []gatewayV1.HTTPQueryParamMatch{{Type: stringOf(gatewayV1.MatchExact), Name: "room", Value: "1"}},
+			},
+			method:   route.Any,
+			agentUrl: "/",
+			headers:  1,
+			query:    1,
+		},
+		{
+			name:  "regular expression header",
+			match: gatewayV1.HTTPRouteMatch{Headers: []gatewayV1.HTTPHeaderMatch{{Type: stringOf("RegularExpression"), Name: "x-version", Value: "2.*"}}},
+			err:   "header match RegularExpression not supported",
+		},
+		{
+			name:  "prefix rewrite",
+			match: gatewayV1.HTTPRouteMatch{Path: &gatewayV1.HTTPPathMatch{Value: stringOf("/api")}},
+			filters: []gatewayV1.HTTPRouteFilter{{
+				Type:       gatewayV1.FilterURLRewrite,
+				URLRewrite: &gatewayV1.HTTPURLRewriteFilter{Path: &gatewayV1.HTTPPathModifier{Type: gatewayV1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: stringOf("/v2")}},
+			}},
+			method:   route.Any,
+			agentUrl: "/api",
+			rewrite:  route.Rewrite{StripPrefix: "/api", AddPrefix: "/v2"},
+		},
+		{
+			name: "full path rewrite",
+			filters: []gatewayV1.HTTPRouteFilter{{
+				Type:       gatewayV1.FilterURLRewrite,
+				URLRewrite: &gatewayV1.HTTPURLRewriteFilter{Path: &gatewayV1.HTTPPathModifier{Type: gatewayV1.FullPathHTTPPathModifier, ReplaceFullPath: stringOf("/game")}},
+			}},
+			method:   route.Any,
+			agentUrl: "/",
+			rewrite:  route.Rewrite{Template: "/game"},
+		},
+		{
+			name:  "prefix rewrite of exact path",
+			match: gatewayV1.HTTPRouteMatch{Path: &gatewayV1.HTTPPathMatch{Type: stringOf(gatewayV1.PathMatchExact), Value: stringOf("/api")}},
+			filters: []gatewayV1.HTTPRouteFilter{{
+				Type:       gatewayV1.FilterURLRewrite,
+				URLRewrite: &gatewayV1.HTTPURLRewriteFilter{Path: &gatewayV1.HTTPPathModifier{Type: gatewayV1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: stringOf("/v2")}},
+			}},
+			err: "path rewrite ReplacePrefixMatch not supported",
+		},
+		{
+			name: "hostname rewrite",
+			filters: []gatewayV1.HTTPRouteFilter{{
+				Type:       gatewayV1.FilterURLRewrite,
+				URLRewrite: &gatewayV1.HTTPURLRewriteFilter{Hostname: stringOf("games.example.com")},
+			}},
+			err: "hostname rewrite not supported",
+		},
+		{
+			name:    "other filter",
+			filters: []gatewayV1.HTTPRouteFilter{{Type: "RequestHeaderModifier"}},
+			err:     "filter RequestHeaderModifier not supported",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := httpRouteRule("games.example.com", test.match, test.filters)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Host != "games.example.com" || r.Method != test.method || r.Match != test.pattern || r.AgentUrl != test.agentUrl {
+				t.Fatalf("rule %s %s %s %s", r.Host, r.Method, r.Match, r.AgentUrl)
+			}
+			if !reflect.DeepEqual(*r.Rewrite, test.rewrite) {
+				t.Fatalf("rewrite %+v", *r.Rewrite)
+			}
+			if len(r.Headers) != test.headers || len(r.Query) != test.query {
+				t.Fatalf("headers %v query %v", r.Headers, r.Query)
+			}
+		})
+	}
+}
+
+func TestHTTPRouteSplits(t *testing.T) {
+	backend := func(name string) httpRouteBackend {
+		return httpRouteBackend{ProxyIp: "http://" + name, Labels: map[string]string{labelBackendRef: name}}
+	}
+	a, b, c := backend("a"), backend("b"), backend("c")
+
+	tests := []struct {
+		name     string
+		backends []httpRouteBackend
+		weights  []int32
+		splits   map[string]int64
+	}{
+		{
+			name:     "one backend",
+			backends: []httpRouteBackend{a},
+			weights:  []int32{10},
+		},
+		{
+			name:     "same weights",
+			backends: []httpRouteBackend{a, b},
+			weights:  []int32{3, 3},
+		},
+		{
+			name:     "canary",
+			backends: []httpRouteBackend{a, b},
+			weights:  []int32{90, 10},
+			splits:   map[string]int64{"a": 90, "b": 10},
+		},
+		{
+			name:     "rounding rest to the first backends",
+			backends: []httpRouteBackend{a, b, c},
+			weights:  []int32{1, 1, 2},
+			splits:   map[string]int64{"a": 25, "b": 25, "c": 50},
+		},
+		{
+			name:     "rounding",
+			backends: []httpRouteBackend{a, b},
+			weights:  []int32{1, 2},
+			splits:   map[string]int64{"a": 34, "b": 66},
+		},
+		{
+			name:     "zero weight dropped",
+			backends: []httpRouteBackend{a, b, c},
+			weights:  []int32{1, 0, 3},
+			splits:   map[string]int64{"a": 25, "c": 75},
+		},
+		{
+			name:     "zero weight leaves one backend",
+			backends: []httpRouteBackend{a, b},
+			weights:  []int32{1, 0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			splits := httpRouteSplits(test.backends, test.weights)
+			var got map[string]int64
+			for _, split := range splits {
+				if got == nil {
+					got = make(map[string]int64)
+				}
+				got[split.Labels[labelBackendRef]] = split.Weight
+			}
+			if !reflect.DeepEqual(got, test.splits) {
+				t.Fatalf("splits %v", got)
+			}
+		})
+	}
+}
+
+func TestHTTPRouteRegistrations(t *testing.T) {
+	ports := newTestService("game-ports", "10.1.0.4", nil)
+	ports.Spec.Ports = append(ports.Spec.Ports, v1.ServicePort{Name: "http-v2", Port: 81, TargetPort: intstr.FromInt(8081)})
+	app, _ := newTestApp(t,
+		newTestService("game", "10.1.0.1", nil),
+		newTestService("game-canary", "10.1.0.2", nil),
+		newTestService("lobby", "10.1.0.3", nil),
+		ports,
+	)
+	backendPortRef := func(name string, port int32, weight *int32) gatewayV1.HTTPBackendRef {
+		return gatewayV1.HTTPBackendRef{
+			BackendObjectReference: gatewayV1.BackendObjectReference{Name: name, Port: int32Of(port)},
+			Weight:                 weight,
+		}
+	}
+	backendRef := func(name string, weight *int32) gatewayV1.HTTPBackendRef {
+		return backendPortRef(name, 80, weight)
+	}
+	obj := &gatewayV1.HTTPRoute{}
+	obj.Namespace = "default"
+	obj.Spec.Hostnames = []string{"games.example.com"}
+	obj.Spec.Rules = []gatewayV1.HTTPRouteRule{{
+		BackendRefs: []gatewayV1.HTTPBackendRef{
+			backendRef("game", int32Of(9)),
+			backendRef("game-canary", int32Of(1)),
+			backendRef("lobby", int32Of(0)),
+		},
+	}}
+
+	//weight 0 takes no requests
+	registrations, errs := app.httpRouteRegistrations(context.Background(), obj)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(registrations) != 2 || registrations[0].ProxyIp != "http://10.1.0.1:80" || registrations[1].ProxyIp != "http://10.1.0.2:80" {
+		t.Fatalf("registrations %v", registrations)
+	}
+	if split := registrations[0].Rule.Split; len(split) != 2 || split[0].Weight != 90 || split[1].Weight != 10 {
+		t.Fatalf("split %v", split)
+	}
+
+	//negative weight is rejected
+	obj.Spec.Rules[0].BackendRefs[2].Weight = int32Of(-1)
+	registrations, errs = app.httpRouteRegistrations(context.Background(), obj)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "negative") || len(registrations) != 2 {
+		t.Fatalf("registrations %v errs %v", registrations, errs)
+	}
+
+	//ports of one service are split apart
+	obj.Spec.Rules[0].BackendRefs = []gatewayV1.HTTPBackendRef{
+		backendPortRef("game-ports", 80, int32Of(3)),
+		backendPortRef("game-ports", 81, int32Of(1)),
+	}
+	registrations, errs = app.httpRouteRegistrations(context.Background(), obj)
+	if len(errs) != 0 || len(registrations) != 2 {
+		t.Fatalf("registrations %v errs %v", registrations, errs)
+	}
+	got := make(map[string]int64)
+	for _, split := range registrations[0].Rule.Split {
+		got[split.Labels[labelBackendRef]] = split.Weight
+	}
+	if !reflect.DeepEqual(got, map[string]int64{"game-ports:80": 75, "game-ports:81": 25}) {
+		t.Fatalf("split %v", got)
+	}
+
+	//the same port referenced twice is rejected
+	obj.Spec.Rules[0].BackendRefs = append(obj.Spec.Rules[0].BackendRefs, backendPortRef("game-ports", 80, int32Of(1)))
+	registrations, errs = app.httpRouteRegistrations(context.Background(), obj)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "referenced twice") || len(registrations) != 2 {
+		t.Fatalf("registrations %v errs %v", registrations, errs)
+	}
+}
+
+func TestHTTPRouteParents(t *testing.T) {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": gatewayV1.Group + "/" + gatewayV1.Version,
+		"kind":       gatewayV1.KindGateway,
+		"metadata":   map[string]interface{}{"namespace": "default", "name": "games"},
+		"spec":       map[string]interface{}{"gatewayClassName": "kubegames"},
+	}}
+	//the fake tracker guesses the resource of kind Gateway wrong, the
+	//gateway is created by its resource
+	client := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gatewayV1.GatewayResource: "GatewayList",
+	})
+	if _, err := client.Resource(gatewayV1.GatewayResource).Namespace("default").Create(context.Background(), u, metaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	app := &proxyAppImp{
+		gatewayClass: "kubegames",
+		gateway:      gateway.NewGateway(client, dynamicinformer.NewDynamicSharedInformerFactory(client, 0)),
+	}
+	obj := &gatewayV1.HTTPRoute{}
+	obj.Namespace = "default"
+	obj.Spec.ParentRefs = []gatewayV1.ParentReference{{Name: "games"}, {Name: "other"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	//gateways are read from the informer cache only
+	if parents := app.httpRouteParents(ctx, obj); len(parents) != 0 {
+		t.Fatalf("parents %v before the cache synced", parents)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "get" {
+			t.Fatalf("gateway read from the api %v", action)
+		}
+	}
+	app.gateway.WatchEvent(ctx, gateway.GatewayHandlerFuncs{})
+	if parents := app.httpRouteParents(ctx, obj); len(parents) != 1 || parents[0].Name != "games" {
+		t.Fatalf("parents %v", parents)
+	}
+}
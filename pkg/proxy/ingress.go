@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/ingress"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+	networkingV1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+//legacy ingress class annotation
+const annotationIngressClass = "kubernetes.io/ingress.class"
+
+//route Ingress objects of ingress class
+func WithIngress(class string) Option {
+	return func(app *proxyAppImp) {
+		app.ingressClass = class
+	}
+}
+
+//watch ingresses, changed ingresses are queued and reconciled by the
+//controller
+func (app *proxyAppImp) watchIngress(ctx context.Context) {
+	app.ingress.WatchEvent(ctx, ingress.IngressHandlerFuncs{
+		AddFunc: func(obj *networkingV1.Ingress) {
+			app.enqueue(route.KindIngress, obj.Namespace, obj.Name)
+		},
+		UpdateFunc: func(oldObj, newObj *networkingV1.Ingress) {
+			if oldObj.ResourceVersion != newObj.ResourceVersion {
+				app.enqueue(route.KindIngress, newObj.Namespace, newObj.Name)
+			}
+		},
+		DeleteFunc: func(obj *networkingV1.Ingress) {
+			app.enqueue(route.KindIngress, obj.Namespace, obj.Name)
+		},
+	})
+}
+
+//route paths of ingress to the cluster ip of their services
+func (app *proxyAppImp) AddIngressRoute(ctx context.Context, obj *networkingV1.Ingress) {
+	owner := route.NewOwner(obj.Namespace, route.KindIngress, obj.Name, string(obj.UID))
+	ref := ingressReference(obj)
+
+	//ingress of another class
+	if !app.ingressSelected(obj) {
+		app.route.Delete(owner)
+		return
+	}
+
+	var registrations []*route.Registration
+	register := func(host, path string, pathType *networkingV1.PathType, backend networkingV1.IngressBackend) {
+		registration, err := app.ingressRegistration(ctx, obj.Namespace, host, path, pathType, backend)
+		if err != nil {
+			log.Errorf("ingress %s %s%s err %s", owner, host, path, err.Error())
+			app.recorder.Warningf(ref, ReasonRejectedRule, "%s%s %s", host, path, err.Error())
+			return
+		}
+		registrations = append(registrations, registration)
+	}
+
+	//default backend
+	if obj.Spec.DefaultBackend != nil {
+		register(route.DefaultHost, "/", nil, *obj.Spec.DefaultBackend)
+	}
+
+	//rules
+	for _, rule := range obj.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			register(rule.Host, path.Path, path.PathType, path.Backend)
+		}
+	}
+	app.replaceRoute(owner, ref, registrations)
+}
+
+//ingress class name or legacy annotation is the ingress class of proxy
+func (app *proxyAppImp) ingressSelected(obj *networkingV1.Ingress) bool {
+	if obj.Spec.IngressClassName != nil {
+		return *obj.Spec.IngressClassName == app.ingressClass
+	}
+	return obj.Annotations[annotationIngressClass] == app.ingressClass
+}
+
+//registration of ingress path, the request path is proxied unchanged
+func (app *proxyAppImp) ingressRegistration(ctx context.Context, namespace, host, path string, pathType *networkingV1.PathType, backend networkingV1.IngressBackend) (*route.Registration, error) {
+	if backend.Service == nil {
+		return nil, fmt.Errorf("resource backend not supported")
+	}
+	if len(path) <= 0 {
+		path = "/"
+	}
+
+	rule := &route.Rule{
+		Method:   route.Any,
+		AgentUrl: path,
+		Host:     host,
+		Rewrite:  new(route.Rewrite),
+	}
+	if pathType != nil && *pathType == networkingV1.PathTypeExact {
+		rule.Match = route.Regex
+		rule.AgentUrl = "^" + regexp.QuoteMeta(path) + "$"
+	} else {
+		//prefix segments of : or * would be params or wildcards
+		for _, segment := range strings.Split(path, "/") {
+			if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+				return nil, fmt.Errorf("path segment %s is not supported by prefix paths", segment)
+			}
+		}
+	}
+	if err := rule.ValidateResolved(); err != nil {
+		return nil, err
+	}
+
+	port := intstr.FromInt(int(backend.Service.Port.Number))
+	if len(backend.Service.Port.Name) > 0 {
+		port = intstr.FromString(backend.Service.Port.Name)
+	}
+	proxyIp, objLabels, err := app.serviceBackend(ctx, namespace, backend.Service.Name, port)
+	if err != nil {
+		return nil, err
+	}
+	return route.NewRegistration(rule, proxyIp, objLabels), nil
+}
+
+//cluster ip backend of service port
+func (app *proxyAppImp) serviceBackend(ctx context.Context, namespace, name string, port intstr.IntOrString) (string, map[string]string, error) {
+	service, err := app.service.Lister().Services(namespace).Get(name)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(service.Spec.ClusterIP) <= 0 || service.Spec.ClusterIP == v1.ClusterIPNone {
+		return "", nil, fmt.Errorf("service %s has no cluster ip", name)
+	}
+	p, err := ServicePort(service, port)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("http://%s:%d", service.Spec.ClusterIP, p), service.Labels, nil
+}
+
+//queue ingresses of namespace after services changed
+func (app *proxyAppImp) enqueueIngresses(namespace string) error {
+	if app.ingress == nil {
+		return nil
+	}
+	list, err := app.ingress.Lister().Ingresses(namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, obj := range list {
+		app.enqueue(route.KindIngress, obj.Namespace, obj.Name)
+	}
+	return nil
+}
+
+//ingress reference
+func ingressReference(obj *networkingV1.Ingress) v1.ObjectReference {
+	return v1.ObjectReference{
+		APIVersion:      "networking.k8s.io/v1",
+		Kind:            "Ingress",
+		Namespace:       obj.Namespace,
+		Name:            obj.Name,
+		UID:             obj.UID,
+		ResourceVersion: obj.ResourceVersion,
+	}
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	networkingV1 "k8s.io/api/networking/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func pathTypeOf(pathType networkingV1.PathType) *networkingV1.PathType {
+	return &pathType
+}
+
+//ingress backend of service port
+func ingressBackend(name string, number int32, port string) networkingV1.IngressBackend {
+	return networkingV1.IngressBackend{
+		Service: &networkingV1.IngressServiceBackend{
+			Name: name,
+			Port: networkingV1.ServiceBackendPort{Name: port, Number: number},
+		},
+	}
+}
+
+func TestIngressRegistration(t *testing.T) {
+	app, _ := newTestApp(t, newTestService("game", "10.1.0.1", nil))
+
+	tests := []struct {
+		name     string
+		path     string
+		pathType *networkingV1.PathType
+		backend  networkingV1.IngressBackend
+		pattern  route.Match
+		agentUrl string
+		proxyIp  string
+		err      string
+	}{
+		{
+			name:     "prefix",
+			path:     "/api/game",
+			pathType: pathTypeOf(networkingV1.PathTypePrefix),
+			backend:  ingressBackend("game", 80, ""),
+			agentUrl: "/api/game",
+			proxyIp:  "http://10.1.0.1:80",
+		},
+		{
+			name:     "implementation specific",
+			path:     "/api/game",
+			pathType: pathTypeOf(networkingV1.PathTypeImplementationSpecific),
+			backend:  ingressBackend("game", 80, ""),
+			agentUrl: "/api/game",
+			proxyIp:  "http://10.1.0.1:80",
+		},
+		{
+			name:     "exact",
+			path:     "/api/game.json",
+			pathType: pathTypeOf(networkingV1.PathTypeExact),
+			backend:  ingressBackend("game", 80, ""),
+			pattern:  route.Regex,
+			agentUrl: `^/api/game\.json$`,
+			proxyIp:  "http://10.1.0.1:80",
+		},
+		{
+			name:     "empty path",
+			backend:  ingressBackend("game", 0, "http"),
+			agentUrl: "/",
+			proxyIp:  "http://10.1.0.1:80",
+		},
+		{
+			name:     "relative path",
+			path:     "api/game",
+			pathType: pathTypeOf(networkingV1.PathTypePrefix),
+			backend:  ingressBackend("game", 80, ""),
+			err:      "should start with /",
+		},
+		{
+			name:     "param segment of prefix path",
+			path:     "/api/:room",
+			pathType: pathTypeOf(networkingV1.PathTypePrefix),
+			backend:  ingressBackend("game", 80, ""),
+			err:      "not supported",
+		},
+		{
+			name:     "wildcard segment of implementation specific path",
+			path:     "/files/*path",
+			pathType: pathTypeOf(networkingV1.PathTypeImplementationSpecific),
+			backend:  ingressBackend("game", 80, ""),
+			err:      "not supported",
+		},
+		{
+			name:    "resource backend",
+			path:    "/",
+			backend: networkingV1.IngressBackend{},
+			err:     "resource backend not supported",
+		},
+		{
+			name:    "unknown port name",
+			path:    "/",
+			backend: ingressBackend("game", 0, "grpc"),
+			err:     "grpc",
+		},
+		{
+			name:    "unknown service",
+			path:    "/",
+			backend: ingressBackend("lobby", 80, ""),
+			err:     "lobby",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registration, err := app.ingressRegistration(context.Background(), "default", "games.example.com", test.path, test.pathType, test.backend)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := registration.Rule
+			if r.Host != "games.example.com" || r.Method != route.Any || r.Match != test.pattern || r.AgentUrl != test.agentUrl || registration.ProxyIp != test.proxyIp {
+				t.Fatalf("registration %s %s %s %s %s", r.Host, r.Method, r.Match, r.AgentUrl, registration.ProxyIp)
+			}
+		})
+	}
+}
+
+func TestAddIngressRoute(t *testing.T) {
+	app, _ := newTestApp(t,
+		newTestService("game", "10.1.0.1", nil),
+		newTestService("docs", "10.1.0.2", nil),
+	)
+	app.ingressClass = "kubegames"
+	class := "kubegames"
+	obj := &networkingV1.Ingress{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: "default", Name: "game", UID: "game"},
+		Spec: networkingV1.IngressSpec{
+			IngressClassName: &class,
+			DefaultBackend:   &networkingV1.IngressBackend{Service: &networkingV1.IngressServiceBackend{Name: "docs", Port: networkingV1.ServiceBackendPort{Number: 80}}},
+			TLS:              []networkingV1.IngressTLS{{Hosts: []string{"games.example.com"}, SecretName: "games-tls"}},
+			Rules: []networkingV1.IngressRule{{
+				Host: "games.example.com",
+				IngressRuleValue: networkingV1.IngressRuleValue{HTTP: &networkingV1.HTTPIngressRuleValue{
+					Paths: []networkingV1.HTTPIngressPath{
+						{Path: "/api", PathType: pathTypeOf(networkingV1.PathTypePrefix), Backend: ingressBackend("game", 80, "")},
+						{Path: "/health", PathType: pathTypeOf(networkingV1.PathTypeExact), Backend: ingressBackend("game", 0, "http")},
+					},
+				}},
+			}},
+		},
+	}
+	app.AddIngressRoute(context.Background(), obj)
+
+	tests := []struct {
+		url     string
+		proxyIp string
+	}{
+		//tls host is routed by its rules, tls ends in front of the proxy
+		{url: "http://games.example.com/api/game", proxyIp: "http://10.1.0.1:80"},
+		{url: "http://games.example.com/health", proxyIp: "http://10.1.0.1:80"},
+		//exact path does not match below it
+		{url: "http://games.example.com/health/live", proxyIp: "http://10.1.0.2:80"},
+		//default backend of every host
+		{url: "http://lobby.example.com/api/game", proxyIp: "http://10.1.0.2:80"},
+	}
+	for _, test := range tests {
+		result, ok := app.route.Lookup(httptest.NewRequest("GET", test.url, nil))
+		if !ok || result.Backend.ProxyIp != test.proxyIp {
+			t.Fatalf("%s should proxy to %s", test.url, test.proxyIp)
+		}
+	}
+
+	//ingress of another class is removed
+	other := "nginx"
+	obj.Spec.IngressClassName = &other
+	app.AddIngressRoute(context.Background(), obj)
+	if _, ok := app.route.Lookup(httptest.NewRequest("GET", "http://games.example.com/api/game", nil)); ok {
+		t.Fatal("ingress of another class should not be routed")
+	}
+
+	//legacy class annotation
+	obj.Spec.IngressClassName = nil
+	obj.Annotations = map[string]string{annotationIngressClass: "kubegames"}
+	app.AddIngressRoute(context.Background(), obj)
+	if _, ok := app.route.Lookup(httptest.NewRequest("GET", "http://games.example.com/api/game", nil)); !ok {
+		t.Fatal("ingress of class annotation should be routed")
+	}
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+)
+
+const (
+	//largest request body copied to a mirror
+	mirrorBodyLimit = 1 << 20
+	//mirror requests in flight, more are dropped
+	mirrorConcurrency = 256
+	//mirror request timeout
+	mirrorTimeout = 10 * time.Second
+)
+
+var (
+	//mirror client
+	mirrorClient = &http.Client{
+		Timeout: mirrorTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	//mirror requests in flight
+	mirrorSlots = make(chan struct{}, mirrorConcurrency)
+)
+
+//copy request to mirror backend fire and forget, call it after the
+//request url is rewritten and before it is proxied. the body is read
+//before the live request is proxied, a slow upload delays it by the
+//time to read at most mirrorBodyLimit bytes, bodies declared larger are
+//not read and not mirrored
+func mirror(backend *route.Backend, r *http.Request) {
+	//upgrade request can not be copied
+	if strings.EqualFold(r.Header.Get("Connection"), "upgrade") || len(r.Header.Get("Upgrade")) > 0 {
+		return
+	}
+
+	//body too large
+	if r.ContentLength > mirrorBodyLimit {
+		log.Tracef("mirror %s body too large", backend.ProxyIp)
+		return
+	}
+
+	//drop when too many mirror requests are in flight
+	select {
+	case mirrorSlots <- struct{}{}:
+	default:
+		log.Tracef("mirror %s dropped", backend.ProxyIp)
+		return
+	}
+
+	//copy body, keep the original readable for the live backend
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		buff, err := ioutil.ReadAll(io.LimitReader(r.Body, mirrorBodyLimit+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buff), r.Body), r.Body}
+		if err != nil || len(buff) > mirrorBodyLimit {
+			<-mirrorSlots
+			log.Tracef("mirror %s body too large", backend.ProxyIp)
+			return
+		}
+		body = buff
+	}
+
+	remote, err := url.Parse(backend.ProxyIp)
+	if err != nil {
+		<-mirrorSlots
+		log.Errorln(err.Error())
+		return
+	}
+
+	//request
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	req := r.Clone(ctx)
+	req.RequestURI = ""
+	req.URL.Scheme = remote.Scheme
+	req.URL.Host = remote.Host
+	req.Host = r.Host
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.TransferEncoding = nil
+	if len(body) <= 0 {
+		req.Body = http.NoBody
+	}
+
+	go func() {
+		defer func() {
+			cancel()
+			<-mirrorSlots
+		}()
+
+		resp, err := mirrorClient.Do(req)
+		if err != nil {
+			log.Tracef("mirror %s err %s", backend.ProxyIp, err.Error())
+			return
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+)
+
+//mirror backend sending received bodies to the channel
+func newMirrorBackend(t *testing.T) (*route.Backend, chan []byte) {
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- body
+	}))
+	t.Cleanup(server.Close)
+	return &route.Backend{ProxyIp: server.URL}, received
+}
+
+//body read by the live backend
+func liveBody(t *testing.T, r *http.Request) []byte {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+//request is not mirrored
+func notMirrored(t *testing.T, received chan []byte) {
+	select {
+	case body := <-received:
+		t.Fatalf("mirrored %d bytes", len(body))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMirror(t *testing.T) {
+	backend, received := newMirrorBackend(t)
+	r := httptest.NewRequest("POST", "http://localhost/api/game", bytes.NewBufferString("hello"))
+	mirror(backend, r)
+
+	//live backend gets the full body
+	if body := liveBody(t, r); string(body) != "hello" {
+		t.Fatalf("live body %q", body)
+	}
+	select {
+	case body := <-received:
+		if string(body) != "hello" {
+			t.Fatalf("mirror body %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request not mirrored")
+	}
+}
+
+func TestMirrorBodyLimit(t *testing.T) {
+	backend, received := newMirrorBackend(t)
+	data := bytes.Repeat([]byte("a"), mirrorBodyLimit+1)
+
+	//declared length
+	r := httptest.NewRequest("POST", "http://localhost/api/game", bytes.NewReader(data))
+	mirror(backend, r)
+	if body := liveBody(t, r); !bytes.Equal(body, data) {
+		t.Fatalf("live body %d bytes", len(body))
+	}
+	notMirrored(t, received)
+
+	//unknown length, the read part is passed on to the live backend
+	r = httptest.NewRequest("POST", "http://localhost/api/game", bytes.NewReader(data))
+	r.ContentLength = -1
+	mirror(backend, r)
+	if body := liveBody(t, r); !bytes.Equal(body, data) {
+		t.Fatalf("live body %d bytes", len(body))
+	}
+	notMirrored(t, received)
+
+	//body at the limit
+	r = httptest.NewRequest("POST", "http://localhost/api/game", bytes.NewReader(data[:mirrorBodyLimit]))
+	mirror(backend, r)
+	if body := liveBody(t, r); len(body) != mirrorBodyLimit {
+		t.Fatalf("live body %d bytes", len(body))
+	}
+	select {
+	case body := <-received:
+		if len(body) != mirrorBodyLimit {
+			t.Fatalf("mirror body %d bytes", len(body))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request not mirrored")
+	}
+}
+
+func TestMirrorDropped(t *testing.T) {
+	backend, received := newMirrorBackend(t)
+
+	//every slot is busy
+	for i := 0; i < mirrorConcurrency; i++ {
+		mirrorSlots <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < mirrorConcurrency; i++ {
+			<-mirrorSlots
+		}
+	}()
+
+	r := httptest.NewRequest("POST", "http://localhost/api/game", bytes.NewBufferString("hello"))
+	mirror(backend, r)
+	if body := liveBody(t, r); string(body) != "hello" {
+		t.Fatalf("live body %q", body)
+	}
+	notMirrored(t, received)
+}
+
+func TestMirrorUpgrade(t *testing.T) {
+	backend, received := newMirrorBackend(t)
+	r := httptest.NewRequest("GET", "http://localhost/api/game", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	mirror(backend, r)
+	notMirrored(t, received)
+	if len(mirrorSlots) != 0 {
+		t.Fatalf("%d mirror slots taken", len(mirrorSlots))
+	}
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+//pod port of rule, a name is looked up in the container ports
+func PodPort(obj *v1.Pod, port intstr.IntOrString) (int32, error) {
+	if port.Type == intstr.Int {
+		return port.IntVal, nil
+	}
+	for _, container := range obj.Spec.Containers {
+		for _, p := range container.Ports {
+			if p.Name == port.StrVal {
+				return p.ContainerPort, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("port %s not found in containers", port.StrVal)
+}
+
+//service port of rule, a name is looked up in the service port names
+//and then in the named target ports
+func ServicePort(obj *v1.Service, port intstr.IntOrString) (int32, error) {
+	if port.Type == intstr.Int {
+		return port.IntVal, nil
+	}
+	for _, p := range obj.Spec.Ports {
+		if p.Name == port.StrVal {
+			return p.Port, nil
+		}
+	}
+	for _, p := range obj.Spec.Ports {
+		if p.TargetPort.Type == intstr.String && p.TargetPort.StrVal == port.StrVal {
+			return p.Port, nil
+		}
+	}
+	return 0, fmt.Errorf("port %s not found in service ports", port.StrVal)
+}
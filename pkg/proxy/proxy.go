@@ -7,19 +7,34 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strings"
-
+	"sync"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/configmap"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/endpointslice"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/event"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/gateway"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/httproute"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/ingress"
 	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/pod"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/proxyroute"
 	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/service"
 	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
 	"github.com/kubegames/kubegames-proxy/pkg/route"
 	v1 "k8s.io/api/core/v1"
+	discoveryV1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/workqueue"
 )
 
 const (
-	//labels proxy
+	//labels proxy, legacy base64 json rules
 	LabelsProxy = "proxy"
+	//annotation proxy v2, plain json or yaml rules with strict validation,
+	//used instead of LabelsProxy when both are set
+	AnnotationProxyV2 = "kubegames.io/proxy.v2"
 	//format time usage
 	timeFormat = "2006-01-02 15:04:05"
 )
@@ -31,250 +46,364 @@ type (
 	}
 
 	proxyAppImp struct {
-		route   *route.Route
-		port    string
-		pod     pod.Pod
-		service service.Service
+		route            *route.Route
+		port             string
+		pod              pod.Pod
+		service          service.Service
+		snapshot         string
+		snapshotInterval time.Duration
+		recorder         *recorder
+		proxyRoute       proxyroute.ProxyRoute
+		ingressClass     string
+		ingress          ingress.Ingress
+		gatewayClass     string
+		gateway          gateway.Gateway
+		httpRoute        httproute.HTTPRoute
+		staticNamespace  string
+		staticName       string
+		configMap        configmap.ConfigMap
+		file             string
+		endpointSlices   bool
+		endpointSlice    endpointslice.EndpointSlice
+		drainGrace       time.Duration
+		drains           map[route.Owner]*time.Timer
+		drainLock        sync.Mutex
+		queue            workqueue.RateLimitingInterface
+		resync           time.Duration
+		waiting          map[queueKey]bool
+		waited           chan struct{}
+		waitLock         sync.Mutex
 	}
+
+	//proxy app option
+	Option func(app *proxyAppImp)
 )
 
-//new app object impl
-func NewProxyApp(port string, clientset *kubernetes.Clientset) ProxyApp {
-	//new share informer factory
-	factory := informers.NewSharedInformerFactory(clientset, 0)
+//persist route table to file every interval, the file is loaded at start
+func WithSnapshot(path string, interval time.Duration) Option {
+	return func(app *proxyAppImp) {
+		app.snapshot = path
+		app.snapshotInterval = interval
+	}
+}
 
+//new app object impl, a nil clientset runs the proxy without cluster
+func NewProxyApp(port string, clientset kubernetes.Interface, opts ...Option) ProxyApp {
 	//new game impl
 	app := &proxyAppImp{
-		pod:     pod.NewPod(clientset, factory),
-		service: service.NewService(clientset, factory),
-		port:    port,
-		route:   route.NewRoute(),
+		port:       port,
+		route:      route.NewRoute(),
+		drainGrace: defaultDrainGrace,
+		resync:     defaultResync,
+		drains:     make(map[route.Owner]*time.Timer),
+	}
+	for _, opt := range opts {
+		opt(app)
+	}
+
+	//without cluster only file routes are served
+	if clientset == nil {
+		return app
+	}
+
+	//new share informer factory
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	app.pod = pod.NewPod(clientset, factory)
+	app.service = service.NewService(clientset, factory)
+	app.recorder = newRecorder(event.NewEvent(clientset, factory))
+	app.queue = newQueue()
+	if app.endpointSlices {
+		app.endpointSlice = endpointslice.NewEndpointSlice(clientset, factory)
+	}
+	if len(app.ingressClass) > 0 {
+		app.ingress = ingress.NewIngress(clientset, factory)
+	}
+	if len(app.staticName) > 0 {
+		app.configMap = newStaticConfigMap(clientset, app.staticNamespace, app.staticName)
 	}
 	return app
 }
 
 //start
 func (app *proxyAppImp) Start(ctx context.Context) error {
-	//pod event
+	//warm start, serve the snapshot while informers sync
+	if len(app.snapshot) > 0 {
+		app.restore()
+		go app.Http()
+	}
+
+	//record events
+	if app.recorder != nil {
+		go app.recorder.run(ctx)
+	}
+
+	//pod and service event
+	if app.pod != nil {
+		app.watchPod(ctx)
+		app.watchService(ctx)
+	}
+
+	//endpoint slice event
+	if app.endpointSlice != nil {
+		app.watchEndpointSlice(ctx)
+	}
+
+	//reconcile queued pods and services
+	if app.queue != nil {
+		app.runController(ctx)
+	}
+
+	//file routes event
+	if len(app.file) > 0 {
+		app.watchFileRoutes(ctx)
+	}
+
+	//proxy route event
+	if app.proxyRoute != nil {
+		app.watchProxyRoute(ctx)
+	}
+
+	//ingress event
+	if app.ingress != nil {
+		app.watchIngress(ctx)
+	}
+
+	//gateway and http route event
+	if app.httpRoute != nil {
+		app.watchHTTPRoute(ctx)
+	}
+
+	//static routes event
+	if app.configMap != nil {
+		app.watchStaticRoutes(ctx)
+	}
+
+	//reconcile snapshot with synced objects
+	if len(app.snapshot) > 0 {
+		app.reconcile(ctx)
+		go app.persist(ctx)
+	} else {
+		go app.Http()
+	}
+
+	log.Infof("proxy app start %s", app.port)
+	<-ctx.Done()
+	return nil
+}
+
+//watch pods, changed pods are queued and reconciled by the controller
+func (app *proxyAppImp) watchPod(ctx context.Context) {
 	app.pod.WatchEvent(ctx, pod.PodHandlerFuncs{
 		AddFunc: func(obj *v1.Pod) {
-			app.AddPodRoute(obj)
+			app.enqueue(route.KindPod, obj.Namespace, obj.Name)
 		},
 		UpdateFunc: func(oldObj, newObj *v1.Pod) {
 			if oldObj.ResourceVersion != newObj.ResourceVersion {
-				obj, err := app.pod.Get(ctx, newObj.Namespace, newObj.Name)
-				if err != nil {
-					return
-				}
-				app.AddPodRoute(obj)
+				app.enqueue(route.KindPod, newObj.Namespace, newObj.Name)
+			}
+			//endpoints of services are split by pod labels
+			if !labels.Equals(oldObj.Labels, newObj.Labels) {
+				app.enqueuePodServices(newObj)
 			}
 		},
 		DeleteFunc: func(obj *v1.Pod) {
-			app.DeletePodRoute(obj)
+			app.enqueue(route.KindPod, obj.Namespace, obj.Name)
 		},
 	})
+}
 
-	//service event
+//watch services, changed services are queued and reconciled by the controller
+func (app *proxyAppImp) watchService(ctx context.Context) {
 	app.service.WatchEvent(ctx, service.ServiceHandlerFuncs{
 		AddFunc: func(obj *v1.Service) {
-			app.AddServiceRoute(obj)
+			app.enqueue(route.KindService, obj.Namespace, obj.Name)
 		},
 		UpdateFunc: func(oldObj, newObj *v1.Service) {
 			if oldObj.ResourceVersion != newObj.ResourceVersion {
-				obj, err := app.service.Get(ctx, newObj.Namespace, newObj.Name)
-				if err != nil {
-					return
-				}
-				app.AddServiceRoute(obj)
+				app.enqueue(route.KindService, newObj.Namespace, newObj.Name)
 			}
 		},
 		DeleteFunc: func(obj *v1.Service) {
-			app.DeleteServiceRoute(obj)
+			app.enqueue(route.KindService, obj.Namespace, obj.Name)
 		},
 	})
-
-	go app.Http()
-
-	log.Infof("proxy app start %s", app.port)
-	<-ctx.Done()
-	return nil
 }
 
-func (app *proxyAppImp) AddServiceRoute(obj *v1.Service) {
-	proxy, ok := obj.Annotations[LabelsProxy]
-	if !ok {
-		return
-	}
+//route service, a failed endpoint slice list is returned
+func (app *proxyAppImp) AddServiceRoute(obj *v1.Service) error {
+	owner := route.NewOwner(obj.Namespace, route.KindService, obj.Name, string(obj.UID))
+	ref := serviceReference(obj)
 
 	//rule
-	rules, err := route.Unmarshal(proxy)
+	rules, ok, err := AnnotationRules(obj.Annotations)
 	if err != nil {
-		log.Errorf("rule unmarshal err %s", err.Error())
-		return
+		//keep the routes of the last valid annotation
+		log.Errorf("service %s rule err %s", owner, err.Error())
+		app.recorder.Warningf(ref, ReasonInvalidAnnotation, "%s", err.Error())
+		return nil
 	}
 
 	//proxy patten
-	if rules.ProxyPattern != route.Service {
-		log.Warnln("rule ProxyPattern != Service")
-		return
-	}
-
-	//register route
-	for _, rule := range rules.Items {
-		//get proxy ip
-		proxyIp := fmt.Sprintf("http://%s:%d", obj.Spec.ClusterIP, rule.Port)
-
-		//add
-		if rule.Method == route.Any {
-			app.route.Add(route.GET, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.POST, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.DELETE, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.PUT, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.PATCH, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.HEAD, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.TRACE, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.OPTIONS, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.CONNECT, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-		} else {
-			app.route.Add(rule.Method, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-		}
+	if ok && rules.ProxyPattern != route.Service {
+		log.Warnf("service %s rule ProxyPattern %s != %s", owner, rules.ProxyPattern, route.Service)
+		app.recorder.Warningf(ref, ReasonPatternMismatch, "proxy pattern %s is ignored on a service", rules.ProxyPattern)
+		ok = false
 	}
-}
 
-func (app *proxyAppImp) DeleteServiceRoute(obj *v1.Service) {
-	proxy, ok := obj.Annotations[LabelsProxy]
-	if !ok {
-		return
+	//headless service without endpoint slices
+	if ok && app.endpointSlice == nil && (len(obj.Spec.ClusterIP) <= 0 || obj.Spec.ClusterIP == v1.ClusterIPNone) {
+		log.Warnf("service %s has no cluster ip", owner)
+		app.recorder.Warningf(ref, ReasonRejectedRule, "service has no cluster ip, route it by endpoint slices")
+		ok = false
 	}
 
-	//port
-	if len(obj.Spec.Ports) <= 0 {
-		return
+	//endpoint slices of the service
+	var slices []*discoveryV1.EndpointSlice
+	if ok && app.endpointSlice != nil {
+		slices, err = app.endpointSlice.Lister().EndpointSlices(obj.Namespace).List(labels.SelectorFromSet(labels.Set{discoveryV1.LabelServiceName: obj.Name}))
+		if err != nil {
+			return err
+		}
 	}
 
-	//rule
-	rules, err := route.Unmarshal(proxy)
-	if err != nil {
-		log.Errorf("rule unmarshal err %s", err.Error())
-		return
-	}
+	//register routes, stale routes of the owner are removed
+	var registrations []*route.Registration
+	if ok {
+		for _, rule := range rules.Items {
+			//ready endpoints of the service port
+			if app.endpointSlice != nil {
+				backends, err := app.endpointBackends(obj, slices, rule.Port)
+				if err != nil {
+					log.Errorf("service %s rule %s err %s", owner, rule.AgentUrl, err.Error())
+					app.recorder.Warningf(ref, ReasonUnresolvedPort, "rule %s %s", rule.AgentUrl, err.Error())
+					continue
+				}
+				for _, backend := range backends {
+					registrations = append(registrations, route.NewRegistration(rule, backend.ProxyIp, backend.Labels))
+				}
+				continue
+			}
 
-	//proxy patten
-	if rules.ProxyPattern != route.Service {
-		log.Warnln("rule ProxyPattern != Service")
-		return
-	}
+			//resolve named port by service ports
+			port, err := ServicePort(obj, rule.Port)
+			if err != nil {
+				log.Errorf("service %s rule %s err %s", owner, rule.AgentUrl, err.Error())
+				app.recorder.Warningf(ref, ReasonUnresolvedPort, "rule %s %s", rule.AgentUrl, err.Error())
+				continue
+			}
 
-	//delete route
-	for _, rule := range rules.Items {
-		if rule.Method == route.Any {
-			app.route.Delete(route.GET, rule.AgentUrl)
-			app.route.Delete(route.POST, rule.AgentUrl)
-			app.route.Delete(route.DELETE, rule.AgentUrl)
-			app.route.Delete(route.PUT, rule.AgentUrl)
-			app.route.Delete(route.PATCH, rule.AgentUrl)
-			app.route.Delete(route.HEAD, rule.AgentUrl)
-			app.route.Delete(route.TRACE, rule.AgentUrl)
-			app.route.Delete(route.OPTIONS, rule.AgentUrl)
-			app.route.Delete(route.CONNECT, rule.AgentUrl)
-		} else {
-			app.route.Delete(rule.Method, rule.AgentUrl)
+			//get proxy ip
+			proxyIp := fmt.Sprintf("http://%s:%d", obj.Spec.ClusterIP, port)
+			registrations = append(registrations, route.NewRegistration(rule, proxyIp, obj.Labels))
 		}
 	}
+	app.replaceRoute(owner, ref, registrations)
+	return nil
 }
 
+//route pod, every failure of a pod is in its spec and recorded as an
+//event, there is nothing to retry
 func (app *proxyAppImp) AddPodRoute(obj *v1.Pod) {
-	proxy, ok := obj.Annotations[LabelsProxy]
-	if !ok {
-		return
-	}
-
-	//check pod is running
-	if obj.Status.Phase != v1.PodRunning {
-		return
-	}
+	owner := route.NewOwner(obj.Namespace, route.KindPod, obj.Name, string(obj.UID))
+	ref := podReference(obj)
 
 	//rule
-	rules, err := route.Unmarshal(proxy)
+	rules, ok, err := AnnotationRules(obj.Annotations)
 	if err != nil {
-		log.Errorf("rule unmarshal err %s", err.Error())
+		//keep the routes of the last valid annotation
+		log.Errorf("pod %s rule err %s", owner, err.Error())
+		app.recorder.Warningf(ref, ReasonInvalidAnnotation, "%s", err.Error())
 		return
 	}
 
 	//proxy patten
-	if rules.ProxyPattern != route.Pod {
-		log.Warnln("rule ProxyPattern != Pod")
-		return
+	if ok && rules.ProxyPattern != route.Pod {
+		log.Warnf("pod %s rule ProxyPattern %s != %s", owner, rules.ProxyPattern, route.Pod)
+		app.recorder.Warningf(ref, ReasonPatternMismatch, "proxy pattern %s is ignored on a pod", rules.ProxyPattern)
+		ok = false
 	}
 
-	//register route
-	for _, rule := range rules.Items {
-		//get proxy ip
-		proxyIp := fmt.Sprintf("http://%s:%d", obj.Status.PodIP, rule.Port)
-
-		if rule.Method == route.Any {
-			app.route.Add(route.GET, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.POST, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.DELETE, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.PUT, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.PATCH, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.HEAD, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.TRACE, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.OPTIONS, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-			app.route.Add(route.CONNECT, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-		} else {
-			app.route.Add(rule.Method, rule.AgentUrl, rule.ProxyUrl, proxyIp)
-		}
+	//check pod is running and ready, a terminating pod is draining
+	routed, draining, remaining := podState(obj, app.drainGrace, time.Now(), app.route.Has(owner))
+	if draining {
+		app.drainAfter(obj, remaining)
 	}
-}
-
-func (app *proxyAppImp) DeletePodRoute(obj *v1.Pod) {
-	proxy, ok := obj.Annotations[LabelsProxy]
-	if !ok {
-		return
+	if !routed {
+		ok = false
 	}
 
-	//check pod is running
-	if obj.Status.Phase != v1.PodRunning {
-		return
-	}
+	//register routes, stale routes of the owner are removed
+	var registrations []*route.Registration
+	if ok {
+		for _, rule := range rules.Items {
+			//resolve named port by container ports
+			port, err := PodPort(obj, rule.Port)
+			if err != nil {
+				log.Errorf("pod %s rule %s err %s", owner, rule.AgentUrl, err.Error())
+				app.recorder.Warningf(ref, ReasonUnresolvedPort, "rule %s %s", rule.AgentUrl, err.Error())
+				continue
+			}
 
-	if len(obj.Spec.Containers) <= 0 {
-		return
+			//get proxy ip
+			proxyIp := fmt.Sprintf("http://%s:%d", obj.Status.PodIP, port)
+			registration := route.NewRegistration(rule, proxyIp, obj.Labels)
+			registration.Draining = draining
+			registrations = append(registrations, registration)
+		}
 	}
-
-	if len(obj.Spec.Containers[0].Ports) <= 0 {
-		return
+	if draining && len(registrations) > 0 {
+		app.recorder.Normalf(ref, ReasonDraining, "draining %d routes, removed %s after termination", len(registrations), app.drainGrace)
 	}
+	app.replaceRoute(owner, ref, registrations)
+}
 
-	//rule
-	rules, err := route.Unmarshal(proxy)
-	if err != nil {
-		log.Errorf("rule unmarshal err %s", err.Error())
-		return
+//rules of annotations, false without proxy annotation
+func AnnotationRules(annotations map[string]string) (*route.Rules, bool, error) {
+	if proxy, ok := annotations[AnnotationProxyV2]; ok {
+		rules, err := route.Parse([]byte(proxy))
+		if err != nil {
+			return nil, false, fmt.Errorf("%s %s", AnnotationProxyV2, err.Error())
+		}
+		return rules, true, nil
 	}
-
-	//proxy patten
-	if rules.ProxyPattern != route.Pod {
-		log.Warnln("rule ProxyPattern != Pod")
-		return
+	if proxy, ok := annotations[LabelsProxy]; ok {
+		rules, err := route.Unmarshal(proxy)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s %s", LabelsProxy, err.Error())
+		}
+		//legacy rules are not validated, but a null item can not be routed
+		for index, rule := range rules.Items {
+			if rule == nil {
+				return nil, false, fmt.Errorf("%s rule %d is empty", LabelsProxy, index)
+			}
+		}
+		return rules, true, nil
 	}
+	return nil, false, nil
+}
 
-	//delete route
-	for _, rule := range rules.Items {
-		if rule.Method == route.Any {
-			app.route.Delete(route.GET, rule.AgentUrl)
-			app.route.Delete(route.POST, rule.AgentUrl)
-			app.route.Delete(route.DELETE, rule.AgentUrl)
-			app.route.Delete(route.PUT, rule.AgentUrl)
-			app.route.Delete(route.PATCH, rule.AgentUrl)
-			app.route.Delete(route.HEAD, rule.AgentUrl)
-			app.route.Delete(route.TRACE, rule.AgentUrl)
-			app.route.Delete(route.OPTIONS, rule.AgentUrl)
-			app.route.Delete(route.CONNECT, rule.AgentUrl)
-		} else {
-			app.route.Delete(rule.Method, rule.AgentUrl)
+//replace routes of owner, rejected and conflicting rules are logged and
+//recorded as events of the object
+func (app *proxyAppImp) replaceRoute(owner route.Owner, ref v1.ObjectReference, registrations []*route.Registration) {
+	if err := app.route.Replace(owner, registrations); err != nil {
+		log.Errorf("replace route %s err %s", owner, err.Error())
+		app.recorder.Warningf(ref, ReasonRejectedRule, "%s", err.Error())
+	}
+	for _, conflict := range app.route.Conflicts(owner) {
+		log.Warnf("route %s %s", owner, conflict)
+		app.recorder.Warningf(ref, ReasonConflictingRoute, "%s", conflict)
+	}
+	if len(registrations) > 0 {
+		//a rule has a registration per endpoint
+		urls := make([]string, 0, len(registrations))
+		seen := make(map[string]bool, len(registrations))
+		for _, registration := range registrations {
+			if !seen[registration.Rule.AgentUrl] {
+				seen[registration.Rule.AgentUrl] = true
+				urls = append(urls, registration.Rule.AgentUrl)
+			}
 		}
+		app.recorder.Normalf(ref, ReasonRegistered, "registered %d routes %s", len(registrations), strings.Join(urls, ", "))
 	}
 }
 
@@ -290,24 +419,37 @@ func (app *proxyAppImp) Http() error {
 
 //proxy
 func (app *proxyAppImp) Proxy(w http.ResponseWriter, r *http.Request) {
-	//get method
-	method := route.Method(strings.ToUpper(r.Method))
-
 	//find route
-	log.Tracef("find url %s", r.URL.Path)
-	proxyIp, proxyPath, ok := app.route.Find(method, r.URL.Path)
+	log.Tracef("find url %s %s%s", r.Method, r.Host, r.URL.Path)
+	result, ok := app.route.Lookup(r)
 	if !ok {
+		//path matches other methods
+		if allow := app.route.Allow(r); len(allow) > 0 {
+			methods := make([]string, len(allow))
+			for index, method := range allow {
+				methods[index] = string(method)
+			}
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			fmt.Fprintf(w, "method not allowed")
+			return
+		}
+
 		w.WriteHeader(http.StatusNotFound)
 		fmt.Fprintf(w, "not found")
 		return
 	}
-
+	backend, proxyPath := result.Backend, result.Path
 	if proxyPath == "/" {
 		proxyPath = ""
 	}
 
+	//outstanding requests
+	backend.Acquire()
+	defer backend.Release()
+
 	//create proxy
-	remote, err := url.Parse(proxyIp)
+	remote, err := url.Parse(backend.ProxyIp)
 	if err != nil {
 		log.Errorln(err.Error())
 		w.WriteHeader(http.StatusBadRequest)
@@ -315,11 +457,34 @@ func (app *proxyAppImp) Proxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//set path
-	r.URL.Path = proxyPath
+	//set escaped path
+	path, err := url.PathUnescape(proxyPath)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "bad request")
+		return
+	}
+	r.URL.Path = path
+	r.URL.RawPath = ""
+	if path != proxyPath {
+		r.URL.RawPath = proxyPath
+	}
+
+	//set query
+	r.URL.RawQuery = result.RawQuery
+
+	//set host
+	if len(result.Host) > 0 {
+		r.Host = result.Host
+	}
+
+	//copy to shadow backend
+	if result.Mirror != nil {
+		mirror(result.Mirror, r)
+	}
 
 	//proxy
-	log.Tracef("proxy %s ===> %s", proxyIp, proxyPath)
+	log.Tracef("proxy %s ===> %s", backend.ProxyIp, proxyPath)
 	proxy := httputil.NewSingleHostReverseProxy(remote)
 	proxy.ServeHTTP(w, r)
 	return
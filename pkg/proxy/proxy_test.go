@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/endpointslice"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/pod"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/service"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+//app of a fake clientset with synced pod and service informers
+func newTestApp(t *testing.T, objects ...runtime.Object) (*proxyAppImp, *fake.Clientset) {
+	return newTestAppWith(t, false, objects...)
+}
+
+//app of a fake clientset routing services by synced endpoint slices
+func newTestEndpointApp(t *testing.T, objects ...runtime.Object) (*proxyAppImp, *fake.Clientset) {
+	return newTestAppWith(t, true, objects...)
+}
+
+func newTestAppWith(t *testing.T, endpointSlices bool, objects ...runtime.Object) (*proxyAppImp, *fake.Clientset) {
+	clientset := fake.NewSimpleClientset(objects...)
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	app := &proxyAppImp{
+		route:      route.NewRoute(),
+		pod:        pod.NewPod(clientset, factory),
+		service:    service.NewService(clientset, factory),
+		recorder:   newRecorder(&fakeEvent{}),
+		drainGrace: defaultDrainGrace,
+		drains:     make(map[route.Owner]*time.Timer),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	//listers register the informers started by the factory
+	app.pod.Lister()
+	app.service.Lister()
+	if endpointSlices {
+		app.endpointSlices = true
+		app.endpointSlice = endpointslice.NewEndpointSlice(clientset, factory)
+		factory.Discovery().V1().EndpointSlices().Informer()
+	}
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	return app, clientset
+}
+
+//running ready pod with a named port
+func newTestPod(name, ip string, labels map[string]string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metaV1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			UID:       types.UID(name),
+			Labels:    labels,
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:  "game",
+				Ports: []v1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+			}},
+		},
+		Status: v1.PodStatus{
+			Phase:      v1.PodRunning,
+			PodIP:      ip,
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}},
+		},
+	}
+}
+
+//cluster ip service with a named port
+func newTestService(name, ip string, labels map[string]string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metaV1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			UID:       types.UID(name),
+			Labels:    labels,
+		},
+		Spec: v1.ServiceSpec{
+			ClusterIP: ip,
+			Ports:     []v1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080)}},
+		},
+	}
+}
+
+func TestProxyMethodNotAllowed(t *testing.T) {
+	app := &proxyAppImp{route: route.NewRoute()}
+	owner := route.NewOwner("default", route.KindPod, "game-0", "game-0")
+	if err := app.route.Replace(owner, []*route.Registration{
+		route.NewRegistration(route.NewRule(route.GET, "/api/game", "/game", 8080), "http://10.0.0.1:8080", nil),
+		route.NewRegistration(route.NewRule(route.POST, "/api/game", "/game", 8080), "http://10.0.0.1:8080", nil),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	//path routed for other methods
+	w := httptest.NewRecorder()
+	app.Proxy(w, httptest.NewRequest("DELETE", "http://localhost/api/game", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, POST" {
+		t.Fatalf("allow %q", allow)
+	}
+
+	//path not routed
+	w = httptest.NewRecorder()
+	app.Proxy(w, httptest.NewRequest("DELETE", "http://localhost/api/lobby", nil))
+	if w.Code != http.StatusNotFound || len(w.Header().Get("Allow")) > 0 {
+		t.Fatalf("status %d allow %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestLegacyAnnotation(t *testing.T) {
+	legacy := func(rules string) *v1.Pod {
+		obj := newTestPod("game-1", "10.0.0.1", nil)
+		obj.Annotations = map[string]string{LabelsProxy: base64.StdEncoding.EncodeToString([]byte(rules))}
+		return obj
+	}
+	events := &fakeEvent{}
+	app := &proxyAppImp{route: route.NewRoute(), recorder: newRecorder(events)}
+
+	//legacy rules are routed without validation
+	app.AddPodRoute(legacy(`{"ProxyPattern":"Pod","Items":[{"Method":"GET","AgentUrl":"/api/game","ProxyUrl":"/game","Port":8080}]}`))
+	if backendOf(app, "/api/game") != "http://10.0.0.1:8080" {
+		t.Fatal("/api/game should proxy to game-1")
+	}
+
+	//null item keeps the last routes and records a warning
+	app.AddPodRoute(legacy(`{"ProxyPattern":"Pod","Items":[null]}`))
+	if backendOf(app, "/api/game") != "http://10.0.0.1:8080" {
+		t.Fatal("routes of the last valid annotation should be kept")
+	}
+	flush(app.recorder)
+	warned := false
+	events.lock.Lock()
+	for _, e := range events.created {
+		warned = warned || (e.Reason == ReasonInvalidAnnotation && e.Type == v1.EventTypeWarning)
+	}
+	events.lock.Unlock()
+	if !warned {
+		t.Fatal("null item should record a warning")
+	}
+}
@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/proxyroute"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	"github.com/kubegames/kubegames-proxy/pkg/apis/v1alpha1"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+)
+
+//route ProxyRoute resources next to the annotations, the crd must be installed
+func WithProxyRoute(client dynamic.Interface) Option {
+	return func(app *proxyAppImp) {
+		factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+		app.proxyRoute = proxyroute.NewProxyRoute(client, factory)
+	}
+}
+
+//watch proxy routes, changed proxy routes are queued and reconciled by
+//the controller
+func (app *proxyAppImp) watchProxyRoute(ctx context.Context) {
+	app.proxyRoute.WatchEvent(ctx, proxyroute.ProxyRouteHandlerFuncs{
+		AddFunc: func(obj *v1alpha1.ProxyRoute) {
+			app.enqueue(route.KindProxyRoute, obj.Namespace, obj.Name)
+		},
+		UpdateFunc: func(oldObj, newObj *v1alpha1.ProxyRoute) {
+			if oldObj.ResourceVersion != newObj.ResourceVersion {
+				app.enqueue(route.KindProxyRoute, newObj.Namespace, newObj.Name)
+			}
+		},
+		DeleteFunc: func(obj *v1alpha1.ProxyRoute) {
+			app.enqueue(route.KindProxyRoute, obj.Namespace, obj.Name)
+		},
+	})
+}
+
+//route selected pods or services of proxy route and report them in
+//status, a failed status update is returned
+func (app *proxyAppImp) AddProxyRoute(ctx context.Context, obj *v1alpha1.ProxyRoute) error {
+	owner := route.NewOwner(obj.Namespace, route.KindProxyRoute, obj.Name, string(obj.UID))
+	ref := proxyRouteReference(obj)
+	status := v1alpha1.ProxyRouteStatus{ObservedGeneration: obj.Generation}
+
+	//selected objects
+	registrations, err := app.proxyRouteRegistrations(ctx, obj, &status)
+	if err != nil {
+		//keep the routes of the last valid spec
+		log.Errorf("proxy route %s err %s", owner, err.Error())
+		app.recorder.Warningf(ref, ReasonInvalidProxyRoute, "%s", err.Error())
+		status.Errors = append(status.Errors, err.Error())
+		return app.updateProxyRouteStatus(ctx, obj, status)
+	}
+
+	//register routes
+	if err := app.route.Replace(owner, registrations); err != nil {
+		log.Errorf("replace route %s err %s", owner, err.Error())
+		app.recorder.Warningf(ref, ReasonRejectedRule, "%s", err.Error())
+		status.Errors = append(status.Errors, err.Error())
+	}
+	for _, conflict := range app.route.Conflicts(owner) {
+		log.Warnf("route %s %s", owner, conflict)
+		app.recorder.Warningf(ref, ReasonConflictingRoute, "%s", conflict)
+		status.Conflicts = append(status.Conflicts, conflict.String())
+	}
+	return app.updateProxyRouteStatus(ctx, obj, status)
+}
+
+//registrations of rules for every selected object, unresolved
+//ports and invalid rules are reported in status
+func (app *proxyAppImp) proxyRouteRegistrations(ctx context.Context, obj *v1alpha1.ProxyRoute, status *v1alpha1.ProxyRouteStatus) ([]*route.Registration, error) {
+	if len(obj.DecodeError) > 0 {
+		return nil, fmt.Errorf("decode %s", obj.DecodeError)
+	}
+	selector := labels.Everything()
+	if obj.Spec.Selector != nil {
+		s, err := metaV1.LabelSelectorAsSelector(obj.Spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("selector %s", err.Error())
+		}
+		selector = s
+	}
+
+	//valid rules
+	var rules []*route.Rule
+	for index, rule := range obj.Spec.Rules {
+		if rule == nil {
+			continue
+		}
+		if err := rule.Validate(); err != nil {
+			status.Errors = append(status.Errors, fmt.Sprintf("rule %d %s", index, err.Error()))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	var registrations []*route.Registration
+	register := func(kind, name, ip string, objLabels map[string]string, draining bool, resolve func(rule *route.Rule) (int32, error)) {
+		for _, rule := range rules {
+			port, err := resolve(rule)
+			if err != nil {
+				status.Errors = append(status.Errors, fmt.Sprintf("%s %s rule %s %s", kind, name, rule.AgentUrl, err.Error()))
+				continue
+			}
+			proxyIp := fmt.Sprintf("http://%s:%d", ip, port)
+			registration := route.NewRegistration(rule, proxyIp, objLabels)
+			registration.Draining = draining
+			registrations = append(registrations, registration)
+			status.Backends = append(status.Backends, v1alpha1.ProxyRouteBackend{
+				Kind:     kind,
+				Name:     name,
+				AgentUrl: rule.AgentUrl,
+				ProxyIp:  proxyIp,
+			})
+		}
+	}
+
+	switch obj.Spec.ProxyPattern {
+	case route.Pod:
+		pods, err := app.pod.Lister().Pods(obj.Namespace).List(selector)
+		if err != nil {
+			return nil, err
+		}
+		//pods of the last status were routed
+		backends := make(map[string]bool, len(obj.Status.Backends))
+		for _, backend := range obj.Status.Backends {
+			if backend.Kind == route.KindPod {
+				backends[backend.Name] = true
+			}
+		}
+		now := time.Now()
+		for _, pod := range pods {
+			//running and ready pods, terminating pods are draining
+			routed, draining, _ := podState(pod, app.drainGrace, now, backends[pod.Name])
+			if !routed {
+				continue
+			}
+			register(route.KindPod, pod.Name, pod.Status.PodIP, pod.Labels, draining, func(rule *route.Rule) (int32, error) {
+				return PodPort(pod, rule.Port)
+			})
+		}
+	case route.Service:
+		services, err := app.service.Lister().Services(obj.Namespace).List(selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, service := range services {
+			if len(service.Spec.ClusterIP) <= 0 || service.Spec.ClusterIP == v1.ClusterIPNone {
+				status.Errors = append(status.Errors, fmt.Sprintf("%s %s has no cluster ip", route.KindService, service.Name))
+				continue
+			}
+			register(route.KindService, service.Name, service.Spec.ClusterIP, service.Labels, false, func(rule *route.Rule) (int32, error) {
+				return ServicePort(service, rule.Port)
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown proxy pattern %q", obj.Spec.ProxyPattern)
+	}
+	return registrations, nil
+}
+
+//update status when it changed, lists are sorted so listing order
+//does not update it again. every replica writes the same status, a
+//write of a stale object conflicts and is skipped, the newer object is
+//queued by its informer update and compared again
+func (app *proxyAppImp) updateProxyRouteStatus(ctx context.Context, obj *v1alpha1.ProxyRoute, status v1alpha1.ProxyRouteStatus) error {
+	sort.Slice(status.Backends, func(i, j int) bool {
+		a, b := status.Backends[i], status.Backends[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.AgentUrl != b.AgentUrl {
+			return a.AgentUrl < b.AgentUrl
+		}
+		return a.ProxyIp < b.ProxyIp
+	})
+	sort.Strings(status.Conflicts)
+	sort.Strings(status.Errors)
+	if reflect.DeepEqual(obj.Status, status) {
+		return nil
+	}
+	obj.Status = status
+	err := app.proxyRoute.UpdateStatus(ctx, obj)
+	if errors.IsConflict(err) {
+		log.Debugf("update proxy route %s/%s status conflict", obj.Namespace, obj.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("update proxy route %s/%s status %s", obj.Namespace, obj.Name, err.Error())
+	}
+	return nil
+}
+
+//queue proxy routes of namespace after pods or services changed
+func (app *proxyAppImp) enqueueProxyRoutes(ctx context.Context, namespace string) error {
+	if app.proxyRoute == nil {
+		return nil
+	}
+	list, err := app.proxyRoute.List(ctx, namespace, labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, obj := range list {
+		app.enqueue(route.KindProxyRoute, obj.Namespace, obj.Name)
+	}
+	return nil
+}
+
+//proxy route reference
+func proxyRouteReference(obj *v1alpha1.ProxyRoute) v1.ObjectReference {
+	return v1.ObjectReference{
+		APIVersion:      v1alpha1.Group + "/" + v1alpha1.Version,
+		Kind:            v1alpha1.KindProxyRoute,
+		Namespace:       obj.Namespace,
+		Name:            obj.Name,
+		UID:             obj.UID,
+		ResourceVersion: obj.ResourceVersion,
+	}
+}
@@ -0,0 +1,283 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/proxyroute"
+	"github.com/kubegames/kubegames-proxy/pkg/apis/v1alpha1"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+//proxy route of pattern and selector
+func newTestProxyRoute(pattern route.ProxyPattern, selector map[string]string, rules ...*route.Rule) *v1alpha1.ProxyRoute {
+	obj := &v1alpha1.ProxyRoute{
+		TypeMeta: metaV1.TypeMeta{
+			APIVersion: v1alpha1.Group + "/" + v1alpha1.Version,
+			Kind:       v1alpha1.KindProxyRoute,
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "game",
+			UID:        "route",
+			Generation: 2,
+		},
+		Spec: v1alpha1.ProxyRouteSpec{
+			ProxyPattern: pattern,
+			Rules:        rules,
+		},
+	}
+	if selector != nil {
+		obj.Spec.Selector = &metaV1.LabelSelector{MatchLabels: selector}
+	}
+	return obj
+}
+
+//proxy route client of a fake dynamic client holding obj
+func newTestProxyRouteClient(t *testing.T, obj *v1alpha1.ProxyRoute) (proxyroute.ProxyRoute, *dynamicFake.FakeDynamicClient) {
+	u, err := obj.ToUnstructured()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		v1alpha1.ProxyRouteResource: "ProxyRouteList",
+	}, u)
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	return proxyroute.NewProxyRoute(client, factory), client
+}
+
+func TestProxyRouteRegistrations(t *testing.T) {
+	game := map[string]string{"app": "game"}
+	notReady := newTestPod("game-2", "10.0.0.2", game)
+	notReady.Status.Conditions[0].Status = v1.ConditionFalse
+	headless := newTestService("game-headless", v1.ClusterIPNone, game)
+	app, _ := newTestApp(t,
+		newTestPod("game-1", "10.0.0.1", game),
+		notReady,
+		newTestPod("lobby-1", "10.0.1.1", map[string]string{"app": "lobby"}),
+		newTestService("game", "10.1.0.1", game),
+		headless,
+	)
+
+	named := route.NewRule(route.GET, "/api/game", "/game", 0)
+	named.Port = intstr.FromString("http")
+	unresolved := route.NewRule(route.GET, "/api/room", "/room", 0)
+	unresolved.Port = intstr.FromString("grpc")
+	invalid := route.NewRule(route.GET, "api/lobby", "/lobby", 8080)
+
+	tests := []struct {
+		name     string
+		obj      *v1alpha1.ProxyRoute
+		proxyIps []string
+		errors   int
+		err      bool
+	}{
+		{
+			name:     "ready pods of selector",
+			obj:      newTestProxyRoute(route.Pod, game, named),
+			proxyIps: []string{"http://10.0.0.1:8080"},
+		},
+		{
+			name:     "every pod without selector",
+			obj:      newTestProxyRoute(route.Pod, nil, route.NewRule(route.GET, "/api/game", "/game", 8080)),
+			proxyIps: []string{"http://10.0.0.1:8080", "http://10.0.1.1:8080"},
+		},
+		{
+			name:     "invalid rules and unresolved ports in status",
+			obj:      newTestProxyRoute(route.Pod, game, named, unresolved, invalid),
+			proxyIps: []string{"http://10.0.0.1:8080"},
+			errors:   2,
+		},
+		{
+			name:     "services with cluster ip, headless services in status",
+			obj:      newTestProxyRoute(route.Service, game, named),
+			proxyIps: []string{"http://10.1.0.1:80"},
+			errors:   1,
+		},
+		{
+			name: "unknown pattern",
+			obj:  newTestProxyRoute(route.ProxyPattern("Job"), game, named),
+			err:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var status v1alpha1.ProxyRouteStatus
+			registrations, err := app.proxyRouteRegistrations(context.Background(), test.obj, &status)
+			if test.err {
+				if err == nil {
+					t.Fatal("error expected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var proxyIps []string
+			for _, registration := range registrations {
+				proxyIps = append(proxyIps, registration.ProxyIp)
+			}
+			sort.Strings(proxyIps)
+			if !reflect.DeepEqual(proxyIps, test.proxyIps) {
+				t.Fatalf("proxy ips %v", proxyIps)
+			}
+			if len(status.Backends) != len(test.proxyIps) || len(status.Errors) != test.errors {
+				t.Fatalf("status %+v", status)
+			}
+		})
+	}
+
+	//invalid selector
+	obj := newTestProxyRoute(route.Pod, nil, named)
+	obj.Spec.Selector = &metaV1.LabelSelector{MatchExpressions: []metaV1.LabelSelectorRequirement{{Key: "app", Operator: "Near"}}}
+	if _, err := app.proxyRouteRegistrations(context.Background(), obj, &v1alpha1.ProxyRouteStatus{}); err == nil {
+		t.Fatal("invalid selector should be rejected")
+	}
+}
+
+func TestProxyRouteStatus(t *testing.T) {
+	obj := newTestProxyRoute(route.Pod, nil)
+	app := &proxyAppImp{}
+	var client *dynamicFake.FakeDynamicClient
+	app.proxyRoute, client = newTestProxyRouteClient(t, obj)
+
+	//lists are sorted
+	status := v1alpha1.ProxyRouteStatus{
+		ObservedGeneration: 2,
+		Backends: []v1alpha1.ProxyRouteBackend{
+			{Kind: route.KindPod, Name: "game-2", AgentUrl: "/api/game", ProxyIp: "http://10.0.0.2:8080"},
+			{Kind: route.KindPod, Name: "game-1", AgentUrl: "/api/game", ProxyIp: "http://10.0.0.1:8080"},
+		},
+		Errors: []string{"rule 1", "rule 0"},
+	}
+	app.updateProxyRouteStatus(context.Background(), obj, status)
+	u, err := client.Resource(v1alpha1.ProxyRouteResource).Namespace("default").Get(context.Background(), "game", metaV1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := v1alpha1.FromUnstructured(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status.Backends[0].Name != "game-1" || updated.Status.Errors[0] != "rule 0" || updated.Status.ObservedGeneration != 2 {
+		t.Fatalf("status %+v", updated.Status)
+	}
+
+	//same status in another order is not updated again
+	actions := len(client.Actions())
+	status.Backends[0], status.Backends[1] = status.Backends[1], status.Backends[0]
+	app.updateProxyRouteStatus(context.Background(), obj, status)
+	if len(client.Actions()) != actions {
+		t.Fatalf("unchanged status updated, actions %v", client.Actions()[actions:])
+	}
+
+	//another replica wrote the status first
+	var updateErr error
+	client.PrependReactor("update", v1alpha1.ProxyRouteResource.Resource, func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, updateErr
+	})
+	updateErr = errors.NewConflict(v1alpha1.ProxyRouteResource.GroupResource(), "game", fmt.Errorf("object has been modified"))
+	if err := app.updateProxyRouteStatus(context.Background(), obj, v1alpha1.ProxyRouteStatus{ObservedGeneration: 3}); err != nil {
+		t.Fatalf("conflict should be skipped, err %s", err.Error())
+	}
+	updateErr = fmt.Errorf("etcd unavailable")
+	if err := app.updateProxyRouteStatus(context.Background(), obj, v1alpha1.ProxyRouteStatus{ObservedGeneration: 4}); err == nil {
+		t.Fatal("failed update should be returned")
+	}
+}
+
+func TestProxyRouteDecode(t *testing.T) {
+	app, _ := newTestApp(t, newTestPod("game-1", "10.0.0.1", nil))
+	decode := func(rule map[string]interface{}) *v1alpha1.ProxyRoute {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": v1alpha1.Group + "/" + v1alpha1.Version,
+			"kind":       v1alpha1.KindProxyRoute,
+			"metadata":   map[string]interface{}{"namespace": "default", "name": "game"},
+			"spec": map[string]interface{}{
+				"proxyPattern": "Pod",
+				"rules":        []interface{}{rule},
+			},
+		}}
+		obj, err := v1alpha1.FromUnstructured(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return obj
+	}
+
+	//camel case and PascalCase keys
+	for _, rule := range []map[string]interface{}{
+		{"method": "GET", "agentUrl": "/api/game", "proxyUrl": "/game", "port": int64(8080)},
+		{"Method": "GET", "AgentUrl": "/api/game", "ProxyUrl": "/game", "Port": int64(8080)},
+	} {
+		obj := decode(rule)
+		if len(obj.DecodeError) > 0 || len(obj.Spec.Rules) != 1 || obj.Spec.Rules[0].AgentUrl != "/api/game" {
+			t.Fatalf("decoded %+v err %s", obj.Spec, obj.DecodeError)
+		}
+	}
+
+	//unknown field is reported instead of routing the spec
+	obj := decode(map[string]interface{}{"method": "GET", "agentUrl": "/api/game", "proxyUrl": "/game", "prot": int64(8080)})
+	if !strings.Contains(obj.DecodeError, "unknown field") {
+		t.Fatalf("decode error %q", obj.DecodeError)
+	}
+	var status v1alpha1.ProxyRouteStatus
+	if _, err := app.proxyRouteRegistrations(context.Background(), obj, &status); err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Fatalf("registrations err %v", err)
+	}
+}
+
+func TestAddProxyRoute(t *testing.T) {
+	game := map[string]string{"app": "game"}
+	app, _ := newTestApp(t, newTestPod("game-1", "10.0.0.1", game))
+	obj := newTestProxyRoute(route.Pod, game, route.NewRule(route.GET, "/api/game", "/game", 8080))
+	var client *dynamicFake.FakeDynamicClient
+	app.proxyRoute, client = newTestProxyRouteClient(t, obj)
+
+	app.AddProxyRoute(context.Background(), obj)
+	result, ok := app.route.Lookup(httptest.NewRequest("GET", "http://games.example.com/api/game", nil))
+	if !ok || result.Backend.ProxyIp != "http://10.0.0.1:8080" {
+		t.Fatal("/api/game should proxy to game-1")
+	}
+	u, err := client.Resource(v1alpha1.ProxyRouteResource).Namespace("default").Get(context.Background(), "game", metaV1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := v1alpha1.FromUnstructured(u)
+	if len(updated.Status.Backends) != 1 || len(updated.Status.Errors) != 0 {
+		t.Fatalf("status %+v", updated.Status)
+	}
+
+	//an invalid spec keeps the last routes and reports the error
+	obj.Spec.ProxyPattern = "Job"
+	app.AddProxyRoute(context.Background(), obj)
+	if _, ok := app.route.Lookup(httptest.NewRequest("GET", "http://games.example.com/api/game", nil)); !ok {
+		t.Fatal("routes of the last valid spec should be kept")
+	}
+	u, _ = client.Resource(v1alpha1.ProxyRouteResource).Namespace("default").Get(context.Background(), "game", metaV1.GetOptions{})
+	updated, _ = v1alpha1.FromUnstructured(u)
+	if len(updated.Status.Errors) != 1 || !strings.Contains(updated.Status.Errors[0], "unknown proxy pattern") {
+		t.Fatalf("status %+v", updated.Status)
+	}
+
+	//deleted route is removed, the informer cache of the client is empty
+	app.sync(context.Background(), queueKey{Kind: route.KindProxyRoute, Namespace: "default", Name: "game"})
+	if _, ok := app.route.Lookup(httptest.NewRequest("GET", "http://games.example.com/api/game", nil)); ok {
+		t.Fatal("deleted proxy route should be removed")
+	}
+}
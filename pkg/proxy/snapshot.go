@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+)
+
+//load snapshot file into route table
+func (app *proxyAppImp) restore() {
+	snapshot, err := route.ReadSnapshot(app.snapshot)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("read snapshot err %s", err.Error())
+		}
+		return
+	}
+	app.route.Restore(snapshot)
+}
+
+//register synced pods, services, proxy routes, ingresses, http routes
+//and static routes again, then drop restored routes of objects gone
+//while the proxy was down. cached objects are queued and the workers
+//reconcile them, the sweep waits until the queue reconciled every one
+func (app *proxyAppImp) reconcile(ctx context.Context) {
+	//without cluster
+	if app.queue == nil {
+		app.route.Sweep()
+		return
+	}
+
+	keys, err := app.cachedKeys(ctx)
+	if err != nil {
+		log.Errorf("reconcile snapshot list err %s", err.Error())
+		return
+	}
+	app.enqueueAndWait(ctx, keys)
+	if ctx.Err() != nil {
+		return
+	}
+	app.syncStaticRoutes(ctx)
+	app.route.Sweep()
+}
+
+//write snapshot file every interval when the route table changed,
+//and once more on exit
+func (app *proxyAppImp) persist(ctx context.Context) {
+	ticker := time.NewTicker(app.snapshotInterval)
+	defer ticker.Stop()
+
+	var version uint64
+	write := func() {
+		if v := app.route.Version(); v != version {
+			if err := route.WriteSnapshot(app.snapshot, app.route.Snapshot()); err != nil {
+				log.Errorf("write snapshot err %s", err.Error())
+				return
+			}
+			version = v
+		}
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			write()
+		case <-ctx.Done():
+			write()
+			return
+		}
+	}
+}
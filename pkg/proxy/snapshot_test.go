@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+)
+
+//snapshot file with routes of pod game-0 and of pod game-9 deleted while
+//the proxy was down
+func writeTestSnapshot(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	table := route.NewRoute()
+	if err := table.Replace(route.NewOwner("default", route.KindPod, "game-0", "game-0"), []*route.Registration{
+		route.NewRegistration(route.NewRule(route.GET, "/api/game", "/game", 8080), "http://10.0.0.1:8080", nil),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Replace(route.NewOwner("default", route.KindPod, "game-9", "game-9"), []*route.Registration{
+		route.NewRegistration(route.NewRule(route.GET, "/api/old", "/old", 8080), "http://10.0.0.9:8080", nil),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "snapshot.json")
+	if err := route.WriteSnapshot(path, table.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWarmStart(t *testing.T) {
+	app, _ := newTestApp(t, newAnnotatedPod("game-0", "10.0.0.1", "game-0"))
+	app.snapshot = writeTestSnapshot(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	//restored routes are served before informers sync
+	app.restore()
+	if backendOf(app, "/api/game") != "http://10.0.0.1:8080" || backendOf(app, "/api/old") != "http://10.0.0.9:8080" {
+		t.Fatal("restored routes should be served")
+	}
+
+	//reconcile registers synced objects, routes of game-9 are swept
+	app.queue = newQueue()
+	app.resync = 0
+	app.runController(ctx)
+	app.reconcile(ctx)
+	if backendOf(app, "/api/old") != "" {
+		t.Fatal("routes of game-9 should be swept")
+	}
+	if backendOf(app, "/api/game") != "http://10.0.0.1:8080" {
+		t.Fatal("/api/game should proxy to game-0")
+	}
+	if owners := app.route.OwnersOf("default", route.KindPod, "game-9"); len(owners) != 0 {
+		t.Fatalf("owners %v", owners)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	app := &proxyAppImp{
+		route:            route.NewRoute(),
+		snapshot:         filepath.Join(dir, "snapshot.json"),
+		snapshotInterval: 10 * time.Millisecond,
+	}
+	if err := app.route.Replace(route.NewOwner("default", route.KindPod, "game-0", "game-0"), []*route.Registration{
+		route.NewRegistration(route.NewRule(route.GET, "/api/game", "/game", 8080), "http://10.0.0.1:8080", nil),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.persist(ctx)
+
+	//wait until the file differs from data
+	read := func(data []byte) []byte {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			current, err := ioutil.ReadFile(app.snapshot)
+			if err == nil && !bytes.Equal(current, data) {
+				return current
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("snapshot not written")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	written := read(nil)
+
+	//unchanged table, snapshot time would differ if it was written again
+	time.Sleep(100 * time.Millisecond)
+	if current, _ := ioutil.ReadFile(app.snapshot); !bytes.Equal(current, written) {
+		t.Fatal("snapshot written without a change")
+	}
+
+	//changed table
+	if err := app.route.Replace(route.NewOwner("default", route.KindPod, "game-1", "game-1"), []*route.Registration{
+		route.NewRegistration(route.NewRule(route.GET, "/api/lobby", "/lobby", 8080), "http://10.0.0.2:8080", nil),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	read(written)
+	snapshot, err := route.ReadSnapshot(app.snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Owners) != 2 {
+		t.Fatalf("snapshot owners %d", len(snapshot.Owners))
+	}
+}
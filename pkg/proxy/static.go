@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/kubernetes/configmap"
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+//route static rules of every key of the config map, the routes of a
+//key are owned by the key and removed with it
+func WithStaticRoutes(namespace, name string) Option {
+	return func(app *proxyAppImp) {
+		app.staticNamespace = namespace
+		app.staticName = name
+	}
+}
+
+//config map of static routes, the informer only watches this config map
+func newStaticConfigMap(clientset kubernetes.Interface, namespace, name string) configmap.ConfigMap {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metaV1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+	return configmap.NewConfigMap(clientset, factory)
+}
+
+//watch static routes config map
+func (app *proxyAppImp) watchStaticRoutes(ctx context.Context) {
+	app.configMap.WatchEvent(ctx, configmap.ConfigMapHandlerFuncs{
+		AddFunc: func(obj *v1.ConfigMap) {
+			app.AddStaticRoutes(obj)
+		},
+		UpdateFunc: func(oldObj, newObj *v1.ConfigMap) {
+			if oldObj.ResourceVersion != newObj.ResourceVersion {
+				app.AddStaticRoutes(newObj)
+			}
+		},
+		DeleteFunc: func(obj *v1.ConfigMap) {
+			app.DeleteStaticRoutes()
+		},
+	})
+}
+
+//route static rules of config map keys, a key with invalid rules keeps
+//its last routes and routes of removed keys are deleted
+func (app *proxyAppImp) AddStaticRoutes(obj *v1.ConfigMap) {
+	if obj.Namespace != app.staticNamespace || obj.Name != app.staticName {
+		return
+	}
+	ref := configMapReference(obj)
+
+	keys := make([]string, 0, len(obj.Data))
+	for key := range obj.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	owners := make(map[route.Owner]bool, len(keys))
+	for _, key := range keys {
+		owner := app.staticOwner(key, string(obj.UID))
+		owners[owner] = true
+
+		rules, err := route.ParseStatic([]byte(obj.Data[key]))
+		if err != nil {
+			//keep the routes of the last valid rules
+			log.Errorf("static routes %s err %s", owner, err.Error())
+			app.recorder.Warningf(ref, ReasonInvalidStaticRoute, "%s %s", key, err.Error())
+			continue
+		}
+		app.replaceRoute(owner, ref, rules.Registrations())
+	}
+
+	//removed keys
+	for _, owner := range app.staticOwners() {
+		if !owners[owner] {
+			app.route.Delete(owner)
+		}
+	}
+}
+
+//delete routes of every key
+func (app *proxyAppImp) DeleteStaticRoutes() {
+	for _, owner := range app.staticOwners() {
+		app.route.Delete(owner)
+	}
+}
+
+//owner of config map key
+func (app *proxyAppImp) staticOwner(key, uid string) route.Owner {
+	return route.NewOwner(app.staticNamespace, route.KindStatic, app.staticName+"/"+key, uid)
+}
+
+//owners of static routes
+func (app *proxyAppImp) staticOwners() []route.Owner {
+	var owners []route.Owner
+	for _, owner := range app.route.Owners() {
+		if owner.Kind == route.KindStatic && owner.Namespace == app.staticNamespace && strings.HasPrefix(owner.Name, app.staticName+"/") {
+			owners = append(owners, owner)
+		}
+	}
+	return owners
+}
+
+//route static routes again, they are removed when the config map is gone
+func (app *proxyAppImp) syncStaticRoutes(ctx context.Context) {
+	if app.configMap == nil {
+		return
+	}
+	obj, err := app.configMap.Get(ctx, app.staticNamespace, app.staticName)
+	if errors.IsNotFound(err) {
+		app.DeleteStaticRoutes()
+		return
+	}
+	if err != nil {
+		log.Errorf("get static routes %s/%s err %s", app.staticNamespace, app.staticName, err.Error())
+		return
+	}
+	app.AddStaticRoutes(obj)
+}
+
+//config map reference
+func configMapReference(obj *v1.ConfigMap) v1.ObjectReference {
+	return v1.ObjectReference{
+		APIVersion:      "v1",
+		Kind:            "ConfigMap",
+		Namespace:       obj.Namespace,
+		Name:            obj.Name,
+		UID:             obj.UID,
+		ResourceVersion: obj.ResourceVersion,
+	}
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/pkg/route"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+//static routes config map
+func newStaticConfigMapObject(uid string, data map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: "kube-system", Name: "kubegames-proxy", UID: types.UID(uid)},
+		Data:       data,
+	}
+}
+
+//uids of the owners of a config map key
+func staticOwnerUIDs(app *proxyAppImp, key string) []string {
+	var uids []string
+	for _, owner := range app.route.OwnersOf("kube-system", route.KindStatic, "kubegames-proxy/"+key) {
+		uids = append(uids, owner.UID)
+	}
+	return uids
+}
+
+func TestStaticRoutes(t *testing.T) {
+	app, clientset := newTestApp(t, newStaticConfigMapObject("1", map[string]string{
+		"a.yaml": fileRules("/api/a", "http://10.0.2.1:8080"),
+		"b.yaml": fileRules("/api/b", "http://10.0.2.2:8080"),
+	}))
+	events := &fakeEvent{}
+	app.recorder = newRecorder(events)
+	app.staticNamespace = "kube-system"
+	app.staticName = "kubegames-proxy"
+	app.configMap = newStaticConfigMap(clientset, app.staticNamespace, app.staticName)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.watchStaticRoutes(ctx)
+
+	//wait until path is routed to backend
+	wait := func(path, backend string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for backendOf(app, path) != backend {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s routed to %q, expected %q", path, backendOf(app, path), backend)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	//every key owns its routes
+	wait("/api/a", "http://10.0.2.1:8080")
+	wait("/api/b", "http://10.0.2.2:8080")
+	if uids := staticOwnerUIDs(app, "a.yaml"); len(uids) != 1 || uids[0] != "1" {
+		t.Fatalf("a.yaml owners %v", uids)
+	}
+	if uids := staticOwnerUIDs(app, "b.yaml"); len(uids) != 1 || uids[0] != "1" {
+		t.Fatalf("b.yaml owners %v", uids)
+	}
+
+	//invalid rules keep the last routes of the key, a deleted key is removed
+	configMaps := clientset.CoreV1().ConfigMaps("kube-system")
+	updated := newStaticConfigMapObject("1", map[string]string{
+		"a.yaml": "Items: []\n",
+	})
+	updated.ResourceVersion = "2"
+	if _, err := configMaps.Update(ctx, updated, metaV1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	wait("/api/b", "")
+	if backendOf(app, "/api/a") != "http://10.0.2.1:8080" {
+		t.Fatal("/api/a should keep its last routes")
+	}
+	if uids := staticOwnerUIDs(app, "b.yaml"); len(uids) != 0 {
+		t.Fatalf("b.yaml owners %v", uids)
+	}
+	flush(app.recorder)
+	warned := false
+	events.lock.Lock()
+	for _, e := range events.created {
+		warned = warned || (e.Reason == ReasonInvalidStaticRoute && e.Type == v1.EventTypeWarning)
+	}
+	events.lock.Unlock()
+	if !warned {
+		t.Fatal("invalid rules should record a warning")
+	}
+
+	//config map recreated with a new uid
+	if err := configMaps.Delete(ctx, "kubegames-proxy", metaV1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	wait("/api/a", "")
+	if _, err := configMaps.Create(ctx, newStaticConfigMapObject("2", map[string]string{
+		"a.yaml": fileRules("/api/a", "http://10.0.2.3:8080"),
+	}), metaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	wait("/api/a", "http://10.0.2.3:8080")
+	if uids := staticOwnerUIDs(app, "a.yaml"); len(uids) != 1 || uids[0] != "2" {
+		t.Fatalf("a.yaml owners %v", uids)
+	}
+
+	//delete of the old config map missed, routes of the old uid are removed
+	app.AddStaticRoutes(newStaticConfigMapObject("3", map[string]string{
+		"a.yaml": fileRules("/api/a", "http://10.0.2.4:8080"),
+	}))
+	if uids := staticOwnerUIDs(app, "a.yaml"); len(uids) != 1 || uids[0] != "3" {
+		t.Fatalf("a.yaml owners %v", uids)
+	}
+	if backendOf(app, "/api/a") != "http://10.0.2.4:8080" {
+		t.Fatal("/api/a should proxy to the routes of the new uid")
+	}
+}
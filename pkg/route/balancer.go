@@ -0,0 +1,128 @@
+package route
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+type (
+	//backend
+	Backend struct {
+		//proxy ip (http://127.0.0.1:8080)
+		ProxyIp string
+		//outstanding requests
+		active int64
+		//entries using this backend, guarded by route lock
+		refs int
+	}
+
+	//balancer pick one backend from pool, key is the request hash key
+	//and only used by consistent hash
+	Balancer interface {
+		Pick(backends []*Backend, key string) *Backend
+	}
+
+	//round robin
+	roundRobin struct {
+		next uint64
+	}
+
+	//random
+	random struct{}
+
+	//least outstanding requests
+	leastRequest struct{}
+
+	//power of two choices
+	powerOfTwo struct{}
+)
+
+//new backend
+func NewBackend(proxyIp string) *Backend {
+	return &Backend{
+		ProxyIp: proxyIp,
+	}
+}
+
+//acquire request
+func (b *Backend) Acquire() {
+	atomic.AddInt64(&b.active, 1)
+}
+
+//release request
+func (b *Backend) Release() {
+	atomic.AddInt64(&b.active, -1)
+}
+
+//outstanding requests
+func (b *Backend) Active() int64 {
+	return atomic.LoadInt64(&b.active)
+}
+
+//new balancer, default round robin
+func NewBalancer(balance Balance) Balancer {
+	switch balance {
+	case Random:
+		return new(random)
+	case LeastRequest:
+		return new(leastRequest)
+	case PowerOfTwo:
+		return new(powerOfTwo)
+	case ConsistentHash:
+		return new(consistentHash)
+	default:
+		return new(roundRobin)
+	}
+}
+
+func (b *roundRobin) Pick(backends []*Backend, key string) *Backend {
+	if len(backends) <= 0 {
+		return nil
+	}
+	next := atomic.AddUint64(&b.next, 1)
+	return backends[(next-1)%uint64(len(backends))]
+}
+
+func (b *random) Pick(backends []*Backend, key string) *Backend {
+	if len(backends) <= 0 {
+		return nil
+	}
+	return backends[rand.Intn(len(backends))]
+}
+
+func (b *leastRequest) Pick(backends []*Backend, key string) *Backend {
+	if len(backends) <= 0 {
+		return nil
+	}
+
+	//start at random offset so ties do not always hit the first backend
+	offset := rand.Intn(len(backends))
+	best := backends[offset]
+	for i := 1; i < len(backends); i++ {
+		backend := backends[(offset+i)%len(backends)]
+		if backend.Active() < best.Active() {
+			best = backend
+		}
+	}
+	return best
+}
+
+func (b *powerOfTwo) Pick(backends []*Backend, key string) *Backend {
+	switch len(backends) {
+	case 0:
+		return nil
+	case 1:
+		return backends[0]
+	}
+
+	//two distinct random choices
+	i := rand.Intn(len(backends))
+	j := rand.Intn(len(backends) - 1)
+	if j >= i {
+		j++
+	}
+	if backends[j].Active() < backends[i].Active() {
+		return backends[j]
+	}
+	return backends[i]
+}
@@ -0,0 +1,33 @@
+package route
+
+import "testing"
+
+func TestBalancer(t *testing.T) {
+	backends := []*Backend{NewBackend("a"), NewBackend("b"), NewBackend("c")}
+
+	for _, balance := range []Balance{RoundRobin, Random, LeastRequest, PowerOfTwo, ConsistentHash} {
+		balancer := NewBalancer(balance)
+		if balancer.Pick(nil, "") != nil {
+			t.Fatalf("%s pick from empty pool", balance)
+		}
+		if balancer.Pick(backends, "") == nil {
+			t.Fatalf("%s pick nil", balance)
+		}
+	}
+
+	//least request skips busy backends
+	backends[0].Acquire()
+	backends[1].Acquire()
+	if backend := NewBalancer(LeastRequest).Pick(backends, ""); backend.ProxyIp != "c" {
+		t.Fatalf("least request pick %s", backend.ProxyIp)
+	}
+
+	//power of two never picks the busiest of two
+	backends[2].Acquire()
+	backends[2].Acquire()
+	for i := 0; i < 100; i++ {
+		if backend := NewBalancer(PowerOfTwo).Pick(backends[1:], ""); backend.ProxyIp != "b" {
+			t.Fatalf("power of two pick %s", backend.ProxyIp)
+		}
+	}
+}
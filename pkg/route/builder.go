@@ -0,0 +1,241 @@
+package route
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type (
+	//location of one target in the table, entries of all owners
+	//registering the same host, method, agent url and conditions
+	location struct {
+		Host     string
+		Method   Method
+		Match    Match
+		AgentUrl string
+		Key      string
+		regexp   *regexp.Regexp
+		entries  []*entry
+		id       string
+	}
+
+	//copy on write builder, clones the parts of the current snapshot
+	//touched by one write and leaves the rest shared
+	builder struct {
+		table *table
+		fresh map[interface{}]bool
+	}
+)
+
+//location identity, param names do not split a location
+func locationId(host string, method Method, match Match, agentUrl string, key string) string {
+	path := agentUrl
+	if match != Regex {
+		segments := []string{}
+		for _, segment := range strings.Split(agentUrl, "/") {
+			if len(segment) <= 0 {
+				continue
+			}
+			if isParam(segment) {
+				segment = ":"
+			}
+			if isWildcard(segment) {
+				segments = append(segments, "*")
+				break
+			}
+			segments = append(segments, segment)
+		}
+		path = strings.Join(segments, "/")
+	}
+	return fmt.Sprintf("%s %s %s %s %s", host, method, match, path, key)
+}
+
+//new builder from snapshot
+func newBuilder(t *table) *builder {
+	b := &builder{
+		table: newTable(),
+		fresh: make(map[interface{}]bool),
+	}
+	for name, host := range t.Hosts {
+		b.table.Hosts[name] = host
+	}
+	return b
+}
+
+//writable host
+func (b *builder) host(name string) *Host {
+	host, ok := b.table.Hosts[name]
+	switch {
+	case !ok:
+		host = newHost()
+	case !b.fresh[host]:
+		clone := *host
+		host = &clone
+	}
+	b.fresh[host] = true
+	b.table.Hosts[name] = host
+	return host
+}
+
+//writable root
+func (b *builder) root(host *Host) *Node {
+	node := host.Root
+	if !b.fresh[node] {
+		node = node.clone()
+	}
+	b.fresh[node] = true
+	host.Root = node
+	return node
+}
+
+//writable child of a writable node
+func (b *builder) child(n *Node, path string) *Node {
+	child, ok := n.Find(path)
+	switch {
+	case !ok:
+		child = newNode()
+	case !b.fresh[child]:
+		child = child.clone()
+	}
+	b.fresh[child] = true
+	n.set(path, child)
+	return child
+}
+
+//set target of location, nil target removes it
+func (b *builder) apply(l *location, target *Target) {
+	host := b.host(l.Host)
+	switch l.Match {
+	case Regex:
+		b.applyRegex(host, l, target)
+	default:
+		b.applyTrie(host, l, target)
+	}
+	if host.empty() {
+		delete(b.table.Hosts, l.Host)
+	}
+}
+
+func (b *builder) applyTrie(host *Host, l *location, target *Target) {
+	node := b.root(host)
+
+	//walk path
+	nodes := []*Node{node}
+	keys := []string{}
+	params := []string{}
+	for _, path := range strings.Split(l.AgentUrl, "/") {
+		if len(path) <= 0 {
+			continue
+		}
+		node = b.child(node, path)
+		nodes = append(nodes, node)
+		keys = append(keys, path)
+		if isParam(path) || isWildcard(path) {
+			params = append(params, path)
+		}
+		if isWildcard(path) {
+			break
+		}
+	}
+
+	//set target
+	if target != nil {
+		target.Params = params
+	}
+	node.replace(l.Method, l.Key, target)
+
+	//prune empty nodes
+	for i := len(keys) - 1; i >= 0; i-- {
+		if !nodes[i+1].empty() {
+			break
+		}
+		nodes[i].remove(keys[i])
+	}
+}
+
+func (b *builder) applyRegex(host *Host, l *location, target *Target) {
+	patterns := host.Regex
+
+	//copy pattern of this source
+	pattern := &Pattern{Source: l.AgentUrl, Regexp: l.regexp, Methods: make(map[Method]Targets)}
+	if o, ok := patterns.Find(l.AgentUrl); ok {
+		for method, targets := range o.Methods {
+			pattern.Methods[method] = targets
+		}
+	}
+	if targets := pattern.Methods[l.Method].Replace(l.Key, target); len(targets) > 0 {
+		pattern.Methods[l.Method] = targets
+	} else {
+		delete(pattern.Methods, l.Method)
+	}
+
+	//copy patterns without this source
+	next := make(Patterns, 0, len(patterns)+1)
+	for _, o := range patterns {
+		if o.Source != l.AgentUrl {
+			next = append(next, o)
+		}
+	}
+	if len(pattern.Methods) > 0 {
+		next = next.Add(pattern)
+	}
+	host.Regex = next
+}
+
+//copy node, children are shared until written
+func (n *Node) clone() *Node {
+	clone := *n
+	clone.Methods = make(map[Method]Targets, len(n.Methods))
+	for method, targets := range n.Methods {
+		clone.Methods[method] = targets
+	}
+	clone.Route = make(map[string]*Node, len(n.Route))
+	for path, child := range n.Route {
+		clone.Route[path] = child
+	}
+	return &clone
+}
+
+//replace target of method by key, nil target removes it
+func (n *Node) replace(method Method, key string, target *Target) {
+	if targets := n.Methods[method].Replace(key, target); len(targets) > 0 {
+		n.Methods[method] = targets
+	} else {
+		delete(n.Methods, method)
+	}
+}
+
+//set child
+func (n *Node) set(path string, child *Node) {
+	switch {
+	case isParam(path):
+		n.Param = child
+	case isWildcard(path):
+		n.Wildcard = child
+	default:
+		n.Route[path] = child
+	}
+}
+
+//remove child
+func (n *Node) remove(path string) {
+	switch {
+	case isParam(path):
+		n.Param = nil
+	case isWildcard(path):
+		n.Wildcard = nil
+	default:
+		delete(n.Route, path)
+	}
+}
+
+//node has no target and no child
+func (n *Node) empty() bool {
+	return len(n.Methods) <= 0 && len(n.Route) <= 0 && n.Param == nil && n.Wildcard == nil
+}
+
+//host has no route
+func (h *Host) empty() bool {
+	return h.Root.empty() && len(h.Regex) <= 0
+}
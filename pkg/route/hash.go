@@ -0,0 +1,126 @@
+package route
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	//hash key source
+	HashHeader HashSource = "Header"
+	HashCookie HashSource = "Cookie"
+	HashQuery  HashSource = "Query"
+	HashParam  HashSource = "Param"
+
+	//virtual nodes per backend on the ring
+	hashReplicas = 160
+)
+
+type (
+	//hash key source
+	HashSource string
+
+	//request value hashed by ConsistentHash balance
+	HashKey struct {
+		//Header, Cookie, Query or Param (path param of agent url)
+		Source HashSource `json:"source"`
+		//header, cookie, query or param name
+		Name string `json:"name"`
+	}
+
+	//ring point
+	hashPoint struct {
+		hash    uint64
+		backend *Backend
+	}
+
+	//consistent hash ring, backends of a target do not change once
+	//it is in a snapshot so the ring is built once on first pick
+	consistentHash struct {
+		once sync.Once
+		ring []hashPoint
+	}
+)
+
+//check source
+func (k *HashKey) Validate() error {
+	if len(k.Name) <= 0 {
+		return fmt.Errorf("hash key name is empty")
+	}
+	switch k.Source {
+	case HashHeader, HashCookie, HashQuery, HashParam:
+		return nil
+	}
+	return fmt.Errorf("hash key %s unknown source %s", k.Name, k.Source)
+}
+
+//request value, empty when the request has none
+func (k *HashKey) Value(r *http.Request, params Params) string {
+	switch k.Source {
+	case HashHeader:
+		return r.Header.Get(k.Name)
+	case HashCookie:
+		if cookie, err := r.Cookie(k.Name); err == nil {
+			return cookie.Value
+		}
+	case HashQuery:
+		if r.URL != nil {
+			return r.URL.Query().Get(k.Name)
+		}
+	case HashParam:
+		return params[k.Name]
+	}
+	return ""
+}
+
+//hash
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+//build ring, points only depend on the backend itself so a backend
+//joining or leaving only remaps the keys next to its own points
+func (b *consistentHash) build(backends []*Backend) {
+	b.ring = make([]hashPoint, 0, len(backends)*hashReplicas)
+	for _, backend := range backends {
+		for i := 0; i < hashReplicas; i++ {
+			b.ring = append(b.ring, hashPoint{
+				hash:    hash(backend.ProxyIp + "#" + strconv.Itoa(i)),
+				backend: backend,
+			})
+		}
+	}
+	sort.Slice(b.ring, func(i, j int) bool {
+		return b.ring[i].hash < b.ring[j].hash
+	})
+}
+
+//pick the first point clockwise from key, random without key
+func (b *consistentHash) Pick(backends []*Backend, key string) *Backend {
+	if len(backends) <= 0 {
+		return nil
+	}
+	if len(key) <= 0 {
+		return backends[rand.Intn(len(backends))]
+	}
+
+	b.once.Do(func() {
+		b.build(backends)
+	})
+
+	h := hash(key)
+	index := sort.Search(len(b.ring), func(i int) bool {
+		return b.ring[i].hash >= h
+	})
+	if index >= len(b.ring) {
+		index = 0
+	}
+	return b.ring[index].backend
+}
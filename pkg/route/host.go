@@ -0,0 +1,33 @@
+package route
+
+import (
+	"net"
+	"strings"
+)
+
+//default host, used by rules without host and as fallback
+const DefaultHost = ""
+
+//lower case host without port
+func NormalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+//hosts to look up for a request host in order: exact host,
+//wildcard host (*.example.com matches one label) and default host
+func Hostnames(host string) []string {
+	host = NormalizeHost(host)
+	if host == DefaultHost {
+		return []string{DefaultHost}
+	}
+
+	names := []string{host}
+	if index := strings.Index(host, "."); index > 0 {
+		names = append(names, "*"+host[index:])
+	}
+	return append(names, DefaultHost)
+}
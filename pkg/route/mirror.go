@@ -0,0 +1,46 @@
+package route
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+//mirror rule, backends registering it receive a copy of the requests
+//matched by the rule instead of live traffic, their responses are dropped
+type Mirror struct {
+	//percent of requests copied (0 - 100)
+	Percent int64 `json:"percent"`
+}
+
+//check percent
+func (m *Mirror) Validate() error {
+	if m.Percent < 0 || m.Percent > 100 {
+		return fmt.Errorf("mirror percent %d out of range", m.Percent)
+	}
+	return nil
+}
+
+//add mirror backend
+func (t *Target) AddMirror(mirror *Mirror, backend *Backend) {
+	t.Mirror = mirror
+	if t.mirrors == nil {
+		t.mirrors = new(roundRobin)
+	}
+	for _, b := range t.Mirrors {
+		if b.ProxyIp == backend.ProxyIp {
+			return
+		}
+	}
+	t.Mirrors = append(t.Mirrors, backend)
+}
+
+//pick mirror backend, nil when the request is not sampled
+func (t *Target) pickMirror() *Backend {
+	if t.Mirror == nil || len(t.Mirrors) <= 0 {
+		return nil
+	}
+	if rand.Int63n(100) >= t.Mirror.Percent {
+		return nil
+	}
+	return t.mirrors.Pick(t.Mirrors, "")
+}
@@ -0,0 +1,138 @@
+package route
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const (
+	//owner kind
+	KindPod        = "Pod"
+	KindService    = "Service"
+	KindProxyRoute = "ProxyRoute"
+	KindIngress    = "Ingress"
+	KindHTTPRoute  = "HTTPRoute"
+	KindStatic     = "Static"
+	KindFile       = "File"
+)
+
+type (
+	//owner of registered routes
+	Owner struct {
+		Namespace string
+		Kind      string
+		Name      string
+		UID       string
+	}
+
+	//route of an owner given to Replace
+	Registration struct {
+		Rule    *Rule
+		ProxyIp string
+		Labels  map[string]string `json:",omitempty"`
+		//backend of a terminating pod, it takes no new requests
+		Draining bool `json:",omitempty"`
+	}
+
+	//route registered by owner, linked to one location per method
+	entry struct {
+		Host    string
+		Methods []Method
+		Rule    *Rule
+		Key     string
+		ProxyIp string
+		Labels  map[string]string
+		//backend takes no new requests
+		Draining bool
+		regexp   *regexp.Regexp
+		//restored from snapshot and not registered again
+		restored bool
+		owner    Owner
+	}
+
+	//route of owner sharing a location with a route of another owner
+	//set up differently (proxy url, rewrite, balance or split), the
+	//latest registered one is used and the split of the first owner
+	Conflict struct {
+		Host     string
+		AgentUrl string
+		//the other owner
+		Owner Owner
+	}
+)
+
+//new owner
+func NewOwner(namespace, kind, name, uid string) Owner {
+	return Owner{
+		Namespace: namespace,
+		Kind:      kind,
+		Name:      name,
+		UID:       uid,
+	}
+}
+
+//namespace/kind/name/uid
+func (o Owner) String() string {
+	return fmt.Sprintf("%s/%s/%s/%s", o.Namespace, o.Kind, o.Name, o.UID)
+}
+
+//new registration
+func NewRegistration(rule *Rule, proxyIp string, labels map[string]string) *Registration {
+	return &Registration{
+		Rule:    rule,
+		ProxyIp: proxyIp,
+		Labels:  labels,
+	}
+}
+
+//entry identity
+func (e *entry) id() string {
+	methods := make([]string, len(e.Methods))
+	for index, method := range e.Methods {
+		methods[index] = string(method)
+	}
+	return strings.Join(methods, ",") + " " + e.location(Any) + " " + e.ProxyIp
+}
+
+//location identity of method
+func (e *entry) location(method Method) string {
+	return locationId(e.Host, method, e.Rule.Match, e.Rule.AgentUrl, e.Key)
+}
+
+//same location set up differently, mirrors are not compared with live routes
+func (e *entry) conflicts(o *entry) bool {
+	if (e.Rule.Mirror == nil) != (o.Rule.Mirror == nil) {
+		return false
+	}
+	return e.Rule.ProxyUrl != o.Rule.ProxyUrl ||
+		e.Rule.Balance != o.Rule.Balance ||
+		!reflect.DeepEqual(e.Rule.Rewrite, o.Rule.Rewrite) ||
+		!reflect.DeepEqual(e.Rule.HashKey, o.Rule.HashKey) ||
+		!reflect.DeepEqual(e.Rule.Split, o.Rule.Split)
+}
+
+//split of entry is the split of its locations in splits, the split
+//of new locations is added
+func (e *entry) sameSplit(splits map[string][]*Split) bool {
+	for _, method := range e.Methods {
+		if split, ok := splits[e.location(method)]; ok && !reflect.DeepEqual(split, e.Rule.Split) {
+			return false
+		}
+	}
+	for _, method := range e.Methods {
+		splits[e.location(method)] = e.Rule.Split
+	}
+	return true
+}
+
+//host agent url and other owner
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s%s conflicts with %s", c.Host, c.AgentUrl, c.Owner)
+}
+
+//same route, backend labels and draining
+func (e *entry) equal(o *entry) bool {
+	return e.ProxyIp == o.ProxyIp && e.Draining == o.Draining && reflect.DeepEqual(e.Rule, o.Rule) && reflect.DeepEqual(e.Labels, o.Labels)
+}
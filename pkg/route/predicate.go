@@ -0,0 +1,214 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	//operator, ordering operators compare dotted versions (2.3 < 2.10)
+	Equal        Operator = "="
+	NotEqual     Operator = "!="
+	Greater      Operator = ">"
+	GreaterEqual Operator = ">="
+	Less         Operator = "<"
+	LessEqual    Operator = "<="
+	Exists       Operator = "exists"
+)
+
+type (
+	//operator
+	Operator string
+
+	//condition on a request header, cookie or query parameter
+	Condition struct {
+		//header, cookie or query name
+		Name string `json:"name"`
+		//operator (default =)
+		Op Operator `json:"op,omitempty"`
+		//value
+		Value string `json:"value,omitempty"`
+	}
+
+	//request conditions, all of them must match
+	Predicate struct {
+		Headers []*Condition
+		Cookies []*Condition
+		Query   []*Condition
+	}
+)
+
+//new condition
+func NewCondition(name string, op Operator, value string) *Condition {
+	return &Condition{
+		Name:  name,
+		Op:    op,
+		Value: value,
+	}
+}
+
+//check operator
+func (c *Condition) Validate() error {
+	if len(c.Name) <= 0 {
+		return fmt.Errorf("condition name is empty")
+	}
+	switch c.Op {
+	case "", Equal, NotEqual, Greater, GreaterEqual, Less, LessEqual, Exists:
+		return nil
+	}
+	return fmt.Errorf("condition %s unknown operator %s", c.Name, c.Op)
+}
+
+//match value, ok is false when the request has no such value
+func (c *Condition) match(value string, ok bool) bool {
+	switch c.Op {
+	case Exists:
+		return ok
+	case NotEqual:
+		return !ok || value != c.Value
+	}
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case Greater:
+		return compareVersion(value, c.Value) > 0
+	case GreaterEqual:
+		return compareVersion(value, c.Value) >= 0
+	case Less:
+		return compareVersion(value, c.Value) < 0
+	case LessEqual:
+		return compareVersion(value, c.Value) <= 0
+	default:
+		return value == c.Value
+	}
+}
+
+func (c *Condition) String() string {
+	op := c.Op
+	if len(op) <= 0 {
+		op = Equal
+	}
+	if op == Exists {
+		return fmt.Sprintf("%s %s", c.Name, op)
+	}
+	return fmt.Sprintf("%s %s %s", c.Name, op, c.Value)
+}
+
+//compare dotted versions part by part, numeric parts as numbers
+func compareVersion(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xerr := strconv.ParseInt(strings.TrimSpace(x), 10, 64)
+		yn, yerr := strconv.ParseInt(strings.TrimSpace(y), 10, 64)
+		if len(x) <= 0 {
+			xn, xerr = 0, nil
+		}
+		if len(y) <= 0 {
+			yn, yerr = 0, nil
+		}
+		switch {
+		case xerr == nil && yerr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+//check conditions
+func (p *Predicate) Validate() error {
+	for _, conditions := range [][]*Condition{p.Headers, p.Cookies, p.Query} {
+		for _, condition := range conditions {
+			if err := condition.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//number of conditions
+func (p *Predicate) Len() int {
+	return len(p.Headers) + len(p.Cookies) + len(p.Query)
+}
+
+//canonical key, predicates with the same conditions share one target
+func (p *Predicate) Key() string {
+	keys := make([]string, 0, p.Len())
+	for _, condition := range p.Headers {
+		keys = append(keys, "header:"+NewCondition(http.CanonicalHeaderKey(condition.Name), condition.Op, condition.Value).String())
+	}
+	for _, condition := range p.Cookies {
+		keys = append(keys, "cookie:"+condition.String())
+	}
+	for _, condition := range p.Query {
+		keys = append(keys, "query:"+condition.String())
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+//match request
+func (p *Predicate) Match(r *http.Request) bool {
+	for _, condition := range p.Headers {
+		values, ok := r.Header[http.CanonicalHeaderKey(condition.Name)]
+		value := ""
+		if ok && len(values) > 0 {
+			value = values[0]
+		}
+		if !condition.match(value, ok) {
+			return false
+		}
+	}
+
+	for _, condition := range p.Cookies {
+		cookie, err := r.Cookie(condition.Name)
+		value := ""
+		if err == nil {
+			value = cookie.Value
+		}
+		if !condition.match(value, err == nil) {
+			return false
+		}
+	}
+
+	if len(p.Query) > 0 {
+		var query url.Values
+		if r.URL != nil {
+			query = r.URL.Query()
+		}
+		for _, condition := range p.Query {
+			values, ok := query[condition.Name]
+			value := ""
+			if ok && len(values) > 0 {
+				value = values[0]
+			}
+			if !condition.match(value, ok) {
+				return false
+			}
+		}
+	}
+	return true
+}
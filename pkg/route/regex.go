@@ -0,0 +1,83 @@
+package route
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	//regular expression route, targets by method
+	Pattern struct {
+		Methods map[Method]Targets
+		Source  string
+		Regexp  *regexp.Regexp
+	}
+
+	//regular expression routes, longest source first
+	Patterns []*Pattern
+)
+
+//new pattern, the expression is anchored at the start of url
+func NewPattern(source string) (*Pattern, error) {
+	expr := source
+	if !strings.HasPrefix(expr, "^") {
+		expr = "^" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Pattern{Methods: make(map[Method]Targets), Source: source, Regexp: re}, nil
+}
+
+//match url, capture groups are named by index ({1}) and by name ({id})
+func (p *Pattern) match(url string) ([]string, Params, bool) {
+	indexes := p.Regexp.FindStringSubmatchIndex(url)
+	if indexes == nil {
+		return nil, nil, false
+	}
+
+	params := make(Params)
+	names := p.Regexp.SubexpNames()
+	for i := 1; i < len(names); i++ {
+		if indexes[i*2] < 0 {
+			continue
+		}
+		value := url[indexes[i*2]:indexes[i*2+1]]
+		params[strconv.Itoa(i)] = value
+		if len(names[i]) > 0 {
+			params[names[i]] = value
+		}
+	}
+
+	//unmatched rest
+	var rest []string
+	if tail := strings.TrimPrefix(url[indexes[1]:], "/"); len(tail) > 0 {
+		rest = strings.Split(tail, "/")
+	}
+	return rest, params, true
+}
+
+//find pattern by source
+func (p Patterns) Find(source string) (*Pattern, bool) {
+	for _, pattern := range p {
+		if pattern.Source == source {
+			return pattern, true
+		}
+	}
+	return nil, false
+}
+
+//add pattern keeping longest source first
+func (p Patterns) Add(pattern *Pattern) Patterns {
+	p = append(p, pattern)
+	sort.SliceStable(p, func(i, j int) bool {
+		if len(p[i].Source) != len(p[j].Source) {
+			return len(p[i].Source) > len(p[j].Source)
+		}
+		return p[i].Source < p[j].Source
+	})
+	return p
+}
@@ -0,0 +1,127 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type (
+	//rewrite of the request url, it replaces ProxyUrl when set.
+	//the request path is stripped, prefixed and then put into Template,
+	//paths stay escaped as received so encoded segments (%2F) are kept
+	Rewrite struct {
+		//prefix removed from request path (/api)
+		StripPrefix string `json:"stripPrefix,omitempty"`
+		//prefix added to request path (/v2)
+		AddPrefix string `json:"addPrefix,omitempty"`
+		//proxy url template, {path} and {query} are the rewritten path
+		//and the request query, {name} the captured params
+		//(/game{path}?room={roomId}&{query}), without ? the request
+		//query is kept
+		Template string `json:"template,omitempty"`
+		//query params set on proxy url
+		AddQuery map[string]string `json:"addQuery,omitempty"`
+		//query params removed from proxy url
+		RemoveQuery []string `json:"removeQuery,omitempty"`
+		//request host sent to the backend (docs.example.com), the
+		//request host is kept when empty
+		Host string `json:"host,omitempty"`
+	}
+)
+
+//check prefixes and template
+func (w *Rewrite) Validate() error {
+	if len(w.StripPrefix) > 0 && !strings.HasPrefix(w.StripPrefix, "/") {
+		return fmt.Errorf("rewrite strip prefix %s should start with /", w.StripPrefix)
+	}
+	if len(w.AddPrefix) > 0 && !strings.HasPrefix(w.AddPrefix, "/") {
+		return fmt.Errorf("rewrite add prefix %s should start with /", w.AddPrefix)
+	}
+	if len(w.Template) > 0 && !strings.HasPrefix(w.Template, "/") && !strings.HasPrefix(w.Template, "{path}") {
+		return fmt.Errorf("rewrite template %s should start with / or {path}", w.Template)
+	}
+	if strings.ContainsAny(w.Host, "/?#@ ") {
+		return fmt.Errorf("rewrite host %s is not a host", w.Host)
+	}
+	return nil
+}
+
+//rewrite request url, params are decoded and raw are escaped for paths
+func (w *Rewrite) rewrite(r *http.Request, params, raw Params) (string, string) {
+	path := r.URL.EscapedPath()
+	query := r.URL.RawQuery
+
+	//strip prefix at segment boundary
+	if prefix := strings.TrimSuffix(w.StripPrefix, "/"); len(prefix) > 0 {
+		if path == prefix {
+			path = "/"
+		} else if strings.HasPrefix(path, prefix+"/") {
+			path = path[len(prefix):]
+		}
+	}
+
+	//add prefix
+	if len(w.AddPrefix) > 0 {
+		path = strings.TrimSuffix(w.AddPrefix, "/") + path
+	}
+
+	//template
+	if len(w.Template) > 0 {
+		template, templateQuery, hasQuery := w.Template, "", false
+		if index := strings.Index(template, "?"); index >= 0 {
+			template, templateQuery, hasQuery = template[:index], template[index+1:], true
+		}
+
+		values := make(Params, len(raw)+1)
+		for name, value := range raw {
+			values[name] = value
+		}
+		values["path"] = path
+		path = expand(template, values, false)
+
+		if hasQuery {
+			templateQuery = expand(templateQuery, params, true)
+			query = strings.Trim(strings.Replace(templateQuery, "{query}", query, -1), "&")
+		}
+	}
+
+	//query params
+	if len(w.AddQuery) > 0 || len(w.RemoveQuery) > 0 {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			values = make(url.Values)
+		}
+		for _, name := range w.RemoveQuery {
+			values.Del(name)
+		}
+		for name, value := range w.AddQuery {
+			values.Set(name, value)
+		}
+		query = values.Encode()
+	}
+	return path, query
+}
+
+//escape decoded path segment by segment
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for index, segment := range segments {
+		segments[index] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+//unescape path segments, invalid escapes are kept as is
+func unescapePaths(raw []string) []string {
+	paths := make([]string, len(raw))
+	for index, segment := range raw {
+		if path, err := url.PathUnescape(segment); err == nil {
+			paths[index] = path
+		} else {
+			paths[index] = segment
+		}
+	}
+	return paths
+}
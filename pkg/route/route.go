@@ -1,38 +1,140 @@
 package route
 
 import (
+	"fmt"
+	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
 )
 
 type (
+	//route table, lookups read an immutable snapshot without lock,
+	//writers copy the touched paths of the snapshot and swap it
 	Route struct {
-		Node map[Method]*Node
-		lock sync.RWMutex
+		table     atomic.Value
+		owners    map[Owner][]*entry
+		names     map[Owner]map[Owner]bool
+		locations map[string]*location
+		backends  map[string]*Backend
+		version   uint64
+		lock      sync.Mutex
 	}
 
+	//immutable snapshot by host, a request host is matched exactly,
+	//then by wildcard (*.example.com) and falls back to the default host ("")
+	table struct {
+		Hosts map[string]*Host
+	}
+
+	//host table, regex routes are matched before the trie,
+	//longest expression first and the first match wins
+	Host struct {
+		Root  *Node
+		Regex Patterns
+	}
+
+	//trie node, targets by method
 	Node struct {
+		Methods  map[Method]Targets
 		Route    map[string]*Node
-		ProxyUrl string
-		ProxyIp  string
+		Param    *Node
+		Wildcard *Node
+	}
+
+	//matched target, the rest of path is escaped. regex captures are
+	//params (decoded) and raw (escaped), trie captures are indexes of
+	//paths (decoded) and raws (escaped)
+	found struct {
+		target  *Target
+		rest    []string
+		params  Params
+		raw     Params
+		paths   []string
+		raws    []string
+		indexes []int
+		escaped bool
+	}
+
+	//lookup result
+	Result struct {
+		//backend serving the request
+		Backend *Backend
+		//escaped proxy path
+		Path string
+		//proxy query
+		RawQuery string
+		//request host sent to the backend, empty to keep the request host
+		Host string
+		//backend receiving a copy of the request, nil when not mirrored
+		Mirror *Backend
 	}
 )
 
 //new route
 func NewRoute() *Route {
-	return &Route{
-		Node: make(map[Method]*Node),
+	r := &Route{
+		owners:    make(map[Owner][]*entry),
+		names:     make(map[Owner]map[Owner]bool),
+		locations: make(map[string]*location),
+		backends:  make(map[string]*Backend),
+	}
+	r.table.Store(newTable())
+	return r
+}
+
+//new table
+func newTable() *table {
+	return &table{
+		Hosts: make(map[string]*Host),
 	}
 }
 
+//new host
+func newHost() *Host {
+	return &Host{
+		Root: newNode(),
+	}
+}
+
+//new node
+func newNode() *Node {
+	return &Node{
+		Methods: make(map[Method]Targets),
+		Route:   make(map[string]*Node),
+	}
+}
+
+//path parameter segment (:roomId)
+func isParam(path string) bool {
+	return strings.HasPrefix(path, ":")
+}
+
+//wildcard segment (*path), it captures the rest of url
+func isWildcard(path string) bool {
+	return strings.HasPrefix(path, "*")
+}
+
 func (n *Node) Add(path string) *Node {
+	switch {
+	case isParam(path):
+		if n.Param == nil {
+			n.Param = newNode()
+		}
+		return n.Param
+	case isWildcard(path):
+		if n.Wildcard == nil {
+			n.Wildcard = newNode()
+		}
+		return n.Wildcard
+	}
+
 	node, ok := n.Route[path]
 	if !ok {
 		//new node
-		node = new(Node)
-		node.Route = make(map[string]*Node)
+		node = newNode()
 	}
 
 	//insert node
@@ -41,104 +143,541 @@ func (n *Node) Add(path string) *Node {
 }
 
 func (n *Node) Find(path string) (*Node, bool) {
-	node, ok := n.Route[path]
-	if !ok {
+	var node *Node
+	switch {
+	case isParam(path):
+		node = n.Param
+	case isWildcard(path):
+		node = n.Wildcard
+	default:
+		node = n.Route[path]
+	}
+	if node == nil {
 		return nil, false
 	}
 	return node, true
 }
 
-func (n *Node) Delete(path string) (*Node, bool) {
-	node, ok := n.Route[path]
-	if !ok {
-		return nil, false
+//match paths of method from index, literal before param before wildcard,
+//the deepest node with a target matching request wins and returns
+//the index of the unmatched rest with the captured indexes in path order,
+//a wildcard captures from its index to the end
+func (n *Node) match(r *http.Request, method Method, paths []string, index int) (*Target, int, []int) {
+	start := index
+	for index < len(paths) && len(paths[index]) <= 0 {
+		index++
 	}
-	delete(n.Route, path)
-	return node, true
+
+	if index < len(paths) {
+		path := paths[index]
+
+		//literal
+		if child, ok := n.Route[path]; ok {
+			if target, rest, indexes := child.match(r, method, paths, index+1); target != nil {
+				return target, rest, indexes
+			}
+		}
+
+		//param
+		if n.Param != nil {
+			if target, rest, indexes := n.Param.match(r, method, paths, index+1); target != nil {
+				return target, rest, append([]int{index}, indexes...)
+			}
+		}
+
+		//wildcard
+		if n.Wildcard != nil {
+			if target := n.Wildcard.Methods[method].Match(r); target != nil {
+				return target, len(paths), []int{index}
+			}
+		}
+	}
+
+	if target := n.Methods[method].Match(r); target != nil {
+		//keep trailing slash
+		if index >= len(paths) {
+			return target, start, nil
+		}
+		return target, index, nil
+	}
+	return nil, 0, nil
 }
 
-//add route
-func (r *Route) Add(method Method, agentUrl string, proxyUrl string, proxyIp string) {
+//add route, labels of the backend select its split
+func (r *Route) Add(owner Owner, rule *Rule, proxyIp string, labels map[string]string) error {
+	e, err := newEntry(rule, proxyIp, labels)
+	if err != nil {
+		return err
+	}
+
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	node, ok := r.Node[method]
+	affected := make(map[*location]bool)
+	r.add(owner, e, affected)
+	r.commit(affected)
+	log.Tracef("add proxy %s %v %s%s ===> %s%s", owner, e.Methods, e.Host, rule.AgentUrl, proxyIp, rule.ProxyUrl)
+	return nil
+}
+
+//delete all routes registered by owner
+func (r *Route) Delete(owner Owner) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	entries, ok := r.owners[owner]
 	if !ok {
-		//new node
-		node = new(Node)
-		node.Route = make(map[string]*Node)
+		return
+	}
+
+	affected := make(map[*location]bool)
+	for _, e := range entries {
+		r.unlink(e, affected)
 	}
-	r.Node[method] = node
+	r.setOwner(owner, nil)
+	r.commit(affected)
+	log.Tracef("delete proxy %s", owner)
+}
+
+//replace all routes of owner in one step, unchanged routes are kept,
+//removed ones deleted and new ones added. invalid registrations are
+//skipped and returned as error, empty registrations delete the owner
+func (r *Route) Replace(owner Owner, registrations []*Registration) error {
+	var errs []string
+	entries := make([]*entry, 0, len(registrations))
+	ids := make(map[string]*entry, len(registrations))
+	splits := make(map[string][]*Split, len(registrations))
+	for _, reg := range registrations {
+		e, err := newEntry(reg.Rule, reg.ProxyIp, reg.Labels)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", reg.Rule.AgentUrl, err.Error()))
+			continue
+		}
+		e.owner = owner
+		e.Draining = reg.Draining
+
+		//one split per location of owner
+		if e.Rule.Mirror == nil && !e.sameSplit(splits) {
+			errs = append(errs, fmt.Sprintf("%s: split conflicts with another rule of %s", reg.Rule.AgentUrl, owner))
+			continue
+		}
 
-	paths := strings.Split(agentUrl, "/")
-	for _, path := range paths {
-		if len(path) <= 0 {
+		//the later registration of the same route wins
+		if o, ok := ids[e.id()]; ok {
+			*o = *e
 			continue
 		}
-		node = node.Add(path)
+		ids[e.id()] = e
+		entries = append(entries, e)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	affected := make(map[*location]bool)
+	next := make([]*entry, 0, len(entries))
+	for _, o := range r.owners[owner] {
+		e, ok := ids[o.id()]
+		switch {
+		case !ok:
+			r.unlink(o, affected)
+		case o.equal(e):
+			o.restored = false
+			next = append(next, o)
+			delete(ids, o.id())
+		default:
+			r.unlink(o, affected)
+		}
 	}
+	for _, e := range entries {
+		if _, ok := ids[e.id()]; ok {
+			r.link(e, affected)
+			next = append(next, e)
+		}
+	}
+	r.setOwner(owner, next)
+	r.commit(affected)
+	log.Tracef("replace proxy %s %d routes", owner, len(next))
 
-	//set
-	node.ProxyUrl = proxyUrl
-	node.ProxyIp = proxyIp
-	log.Tracef("add proxy %s %s ===> %s%s", method, agentUrl, node.ProxyIp, node.ProxyUrl)
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
 }
 
-//delete
-func (r *Route) Delete(method Method, url string) {
+//routes of other owners conflicting with the routes of owner
+func (r *Route) Conflicts(owner Owner) []Conflict {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	node, ok := r.Node[method]
-	if !ok {
+	var conflicts []Conflict
+	seen := make(map[Conflict]bool)
+	for _, e := range r.owners[owner] {
+		for _, method := range e.Methods {
+			l, ok := r.locations[e.location(method)]
+			if !ok {
+				continue
+			}
+			for _, o := range l.entries {
+				if o.owner == owner || !e.conflicts(o) {
+					continue
+				}
+				c := Conflict{Host: e.Host, AgentUrl: e.Rule.AgentUrl, Owner: o.owner}
+				if !seen[c] {
+					seen[c] = true
+					conflicts = append(conflicts, c)
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+//owners of registered routes
+func (r *Route) Owners() []Owner {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	owners := make([]Owner, 0, len(r.owners))
+	for owner := range r.owners {
+		owners = append(owners, owner)
+	}
+	return owners
+}
+
+//owner has registered routes
+func (r *Route) Has(owner Owner) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	_, ok := r.owners[owner]
+	return ok
+}
+
+//owners of namespace kind and name, one per uid
+func (r *Route) OwnersOf(namespace, kind, name string) []Owner {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	set := r.names[NewOwner(namespace, kind, name, "")]
+	owners := make([]Owner, 0, len(set))
+	for owner := range set {
+		owners = append(owners, owner)
+	}
+	return owners
+}
+
+//set entries of owner and index it by name, an owner without entries
+//is removed
+func (r *Route) setOwner(owner Owner, entries []*entry) {
+	name := NewOwner(owner.Namespace, owner.Kind, owner.Name, "")
+	if len(entries) <= 0 {
+		delete(r.owners, owner)
+		if set, ok := r.names[name]; ok {
+			delete(set, owner)
+			if len(set) <= 0 {
+				delete(r.names, name)
+			}
+		}
 		return
 	}
+	r.owners[owner] = entries
+	set, ok := r.names[name]
+	if !ok {
+		set = make(map[Owner]bool)
+		r.names[name] = set
+	}
+	set[owner] = true
+}
 
-	paths := strings.Split(url, "/")
-	for _, path := range paths {
-		if len(path) <= 0 {
-			continue
+//new entry, check rule before it reaches the table
+func newEntry(rule *Rule, proxyIp string, labels map[string]string) (*entry, error) {
+	if err := rule.validate(); err != nil {
+		return nil, err
+	}
+	methods, _ := rule.MethodSet()
+	predicate := rule.Predicate()
+
+	copied := *rule
+	e := &entry{
+		Host:    NormalizeHost(rule.Host),
+		Methods: methods,
+		Rule:    &copied,
+		Key:     predicate.Key(),
+		ProxyIp: proxyIp,
+		Labels:  labels,
+	}
+	if rule.Match == Regex {
+		pattern, err := NewPattern(rule.AgentUrl)
+		if err != nil {
+			return nil, err
 		}
-		n, ok := node.Delete(path)
-		if !ok {
+		e.regexp = pattern.Regexp
+	}
+	return e, nil
+}
+
+//add or update owner entry
+func (r *Route) add(owner Owner, e *entry, affected map[*location]bool) {
+	e.owner = owner
+	id := e.id()
+	entries := r.owners[owner]
+	for index, o := range entries {
+		if o.id() == id {
+			r.unlink(o, affected)
+			entries = append(entries[:index:index], entries[index+1:]...)
 			break
 		}
-		node = n
 	}
-	log.Tracef("delete proxy %s %s", method, url)
+	r.setOwner(owner, append(entries, e))
+	r.link(e, affected)
 }
 
-//find
-func (r *Route) Find(method Method, url string) (string, string, bool) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
+//link entry to the location of each method, the latest entry sets
+//proxy url and balance
+func (r *Route) link(e *entry, affected map[*location]bool) {
+	for _, method := range e.Methods {
+		id := e.location(method)
+		l, ok := r.locations[id]
+		if !ok {
+			l = &location{
+				id:     id,
+				Host:   e.Host,
+				Method: method,
+				Match:  e.Rule.Match,
+				Key:    e.Key,
+				regexp: e.regexp,
+			}
+			r.locations[id] = l
+		}
+		l.AgentUrl = e.Rule.AgentUrl
+		l.entries = append(l.entries, e)
+		affected[l] = true
+	}
 
-	node, ok := r.Node[method]
+	//backend
+	backend, ok := r.backends[e.ProxyIp]
 	if !ok {
-		return "", "", false
+		backend = NewBackend(e.ProxyIp)
+		r.backends[e.ProxyIp] = backend
+	}
+	backend.refs++
+}
+
+//unlink entry from its locations
+func (r *Route) unlink(e *entry, affected map[*location]bool) {
+	for _, method := range e.Methods {
+		id := e.location(method)
+		l, ok := r.locations[id]
+		if !ok {
+			continue
+		}
+		for index, o := range l.entries {
+			if o == e {
+				l.entries = append(l.entries[:index:index], l.entries[index+1:]...)
+				break
+			}
+		}
+		affected[l] = true
 	}
 
-	paths := strings.Split(url, "/")
-	route := ""
-	for index, path := range paths {
-		if len(path) <= 0 {
+	//backend
+	if backend, ok := r.backends[e.ProxyIp]; ok {
+		if backend.refs--; backend.refs <= 0 {
+			delete(r.backends, e.ProxyIp)
+		}
+	}
+}
+
+//build target of location
+func (r *Route) target(l *location) *Target {
+	if len(l.entries) <= 0 {
+		return nil
+	}
+	latest := l.entries[len(l.entries)-1].Rule
+	target := NewTarget(latest.Predicate())
+	live := make([]*entry, 0, len(l.entries))
+	var draining []*Backend
+	for _, e := range l.entries {
+		//shadow backend
+		if e.Rule.Mirror != nil {
+			target.AddMirror(e.Rule.Mirror, r.backends[e.ProxyIp])
+			continue
+		}
+		latest = e.Rule
+		target.Set(e.Rule)
+		if e.Draining {
+			draining = append(draining, r.backends[e.ProxyIp])
 			continue
 		}
-		n, ok := node.Find(path)
+		live = append(live, e)
+		target.AddBackend(r.backends[e.ProxyIp])
+	}
+	for _, backend := range draining {
+		target.AddDraining(backend)
+	}
+	target.split(splitOf(live), live, r.backends)
+	return target
+}
+
+//split of the first owner, it does not depend on registration order
+func splitOf(entries []*entry) []*Split {
+	var first *entry
+	for _, e := range entries {
+		if first == nil || e.owner.String() < first.owner.String() {
+			first = e
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	return first.Rule.Split
+}
+
+//copy touched locations into a new snapshot and swap it
+func (r *Route) commit(affected map[*location]bool) {
+	if len(affected) <= 0 {
+		return
+	}
+	b := newBuilder(r.load())
+	for l := range affected {
+		b.apply(l, r.target(l))
+		//empty location is dropped once applied, a link in the same
+		//write reuses it
+		if len(l.entries) <= 0 {
+			delete(r.locations, l.id)
+		}
+	}
+	r.table.Store(b.table)
+	r.version++
+}
+
+//current snapshot
+func (r *Route) load() *table {
+	return r.table.Load().(*table)
+}
+
+//find backend and proxy url (path?query) by request
+func (r *Route) Find(req *http.Request) (*Backend, string, bool) {
+	result, ok := r.Lookup(req)
+	if !ok {
+		return nil, "", false
+	}
+	if len(result.RawQuery) > 0 {
+		return result.Backend, result.Path + "?" + result.RawQuery, true
+	}
+	return result.Backend, result.Path, true
+}
+
+//lookup by request host, exact host then wildcard host then default host
+func (r *Route) Lookup(req *http.Request) (*Result, bool) {
+	method := Method(strings.ToUpper(req.Method))
+	f, ok := r.load().match(req, method)
+	if !ok {
+		return nil, false
+	}
+
+	//captured params of trie, built here so they stay on stack
+	params, raw := f.params, f.raw
+	if params == nil && len(f.target.Params) > 0 {
+		params = make(Params, len(f.target.Params))
+		raw = params
+		if f.escaped {
+			raw = make(Params, len(f.target.Params))
+		}
+		for i, name := range f.target.Params {
+			if i >= len(f.indexes) {
+				break
+			}
+			index := f.indexes[i]
+			if isWildcard(name) {
+				params[name[1:]] = strings.Join(f.paths[index:], "/")
+				raw[name[1:]] = strings.Join(f.raws[index:], "/")
+			} else {
+				params[name[1:]] = f.paths[index]
+				raw[name[1:]] = f.raws[index]
+			}
+		}
+	}
+	return f.target.result(req, f.rest, params, raw)
+}
+
+//methods allowed for request path, empty when no method matches
+func (r *Route) Allow(req *http.Request) []Method {
+	t := r.load()
+
+	var allow []Method
+	for _, method := range methods {
+		if _, ok := t.match(req, method); ok {
+			allow = append(allow, method)
+		}
+	}
+	return allow
+}
+
+//match request by host
+func (t *table) match(req *http.Request, method Method) (found, bool) {
+	for _, name := range Hostnames(req.Host) {
+		host, ok := t.Hosts[name]
 		if !ok {
-			proxy := strings.Split(node.ProxyUrl, "/")
-			proxy = append(proxy, paths[index:]...)
-			route = strings.Join(proxy, "/")
-			break
+			continue
+		}
+		if f, ok := host.match(req, method); ok {
+			return f, true
 		}
-		node = n
 	}
+	return found{}, false
+}
+
+//match target, regex routes first then the trie
+func (h *Host) match(r *http.Request, method Method) (found, bool) {
+	//regex
+	for _, pattern := range h.Regex {
+		targets, ok := pattern.Methods[method]
+		if !ok {
+			continue
+		}
+		rest, params, ok := pattern.match(r.URL.Path)
+		if !ok {
+			continue
+		}
+		target := targets.Match(r)
+		if target == nil {
+			continue
+		}
 
-	//check
-	if len(node.ProxyIp) <= 0 {
-		return "", "", false
+		//escape decoded captures for paths
+		raw := make(Params, len(params))
+		for name, value := range params {
+			raw[name] = escapePath(value)
+		}
+		for index, path := range rest {
+			rest[index] = escapePath(path)
+		}
+		return found{target: target, rest: rest, params: params, raw: raw}, true
 	}
 
-	//return
-	return node.ProxyIp, route, true
+	//match decoded segments, keep escaped ones for the proxy url
+	escaped := r.URL.EscapedPath()
+	raws := strings.Split(escaped, "/")
+	paths := raws
+	if strings.Contains(escaped, "%") {
+		paths = unescapePaths(raws)
+	}
+	start := 0
+	if strings.HasPrefix(escaped, "/") {
+		start = 1
+	}
+	target, rest, indexes := h.Root.match(r, method, paths, start)
+	if target == nil {
+		return found{}, false
+	}
+	return found{
+		target:  target,
+		rest:    raws[rest:],
+		paths:   paths,
+		raws:    raws,
+		indexes: indexes,
+		escaped: escaped != r.URL.Path,
+	}, true
 }
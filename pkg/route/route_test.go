@@ -2,9 +2,28 @@ package route
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+//new request
+func newRequest(method Method, host, path string) *http.Request {
+	return &http.Request{
+		Method: string(method),
+		Host:   host,
+		URL:    &url.URL{Path: path},
+		Header: make(http.Header),
+	}
+}
+
 func TestRule(*testing.T) {
 	rules := NewRules(Service, NewRule(Any, "/api", "/api", 8433))
 	base64, err := Marshal(rules)
@@ -15,43 +34,975 @@ func TestRule(*testing.T) {
 	}
 }
 
+func TestParse(t *testing.T) {
+	yaml := `
+ProxyPattern: Pod
+Items:
+- Methods: [GET, POST]
+  AgentUrl: /api/room/:roomId
+  ProxyUrl: /room/{roomId}
+  Port: 8080
+  Headers:
+  - Name: X-Client-Version
+    Op: ">="
+    Value: "2.0"
+`
+	rules, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules.Items) != 1 || rules.Items[0].Port.IntValue() != 8080 || len(rules.Items[0].Headers) != 1 {
+		t.Fatalf("parse %+v", rules.Items[0])
+	}
+	if _, err := Parse([]byte(`{"ProxyPattern":"Pod","Items":[{"Method":"GET","AgentUrl":"/api","ProxyUrl":"/api","Port":8080}]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	//named port
+	rules, err = Parse([]byte(`{"ProxyPattern":"Pod","Items":[{"Method":"GET","AgentUrl":"/api","ProxyUrl":"/api","Port":"http-game"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules.Items[0].Port.Type != intstr.String || rules.Items[0].Port.StrVal != "http-game" {
+		t.Fatalf("named port %+v", rules.Items[0].Port)
+	}
+
+	//legacy annotation keeps numeric ports
+	legacy, err := Marshal(NewRules(Pod, NewRule(GET, "/api", "/api", 8080)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules, err := Unmarshal(legacy); err != nil || rules.Items[0].Port.IntValue() != 8080 {
+		t.Fatalf("legacy port %v", err)
+	}
+
+	tests := []string{
+		`{"ProxyPattern":"Pod","Items":[{"Method":"GET","AgentUrl":"/api","ProxyUrl":"/api","Port":8080,"Prot":1}]}`,
+		`{"ProxyPattern":"Job","Items":[{"Method":"GET","AgentUrl":"/api","ProxyUrl":"/api","Port":8080}]}`,
+		`{"ProxyPattern":"Pod","Items":[{"Method":"GET","AgentUrl":"/api","ProxyUrl":"/api","Port":70000}]}`,
+		`{"ProxyPattern":"Pod","Items":[{"Method":"GET","AgentUrl":"/api","ProxyUrl":"/api","Port":"http_game"}]}`,
+		`{"ProxyPattern":"Pod","Items":[{"Method":"GET","AgentUrl":"/api","ProxyUrl":"/api","Port":"8080"}]}`,
+		`{"ProxyPattern":"Pod","Items":[{"Method":"GET","AgentUrl":"api","ProxyUrl":"/api","Port":8080}]}`,
+		`{"ProxyPattern":"Pod","Items":[{"Method":"GET","AgentUrl":"/api","ProxyUrl":"api","Port":8080}]}`,
+		`{"ProxyPattern":"Pod","Items":[{"Method":"FETCH","AgentUrl":"/api","ProxyUrl":"/api","Port":8080}]}`,
+		`{"ProxyPattern":"Pod","Items":[]}`,
+	}
+	for _, test := range tests {
+		if _, err := Parse([]byte(test)); err == nil {
+			t.Fatalf("%s should be rejected", test)
+		}
+	}
+}
+
 func TestRoute(*testing.T) {
 	route := NewRoute()
+	game := NewOwner("default", KindService, "game", "1")
+	swagger := NewOwner("default", KindService, "swagger", "2")
 
 	//api
-	route.Add(GET, "/api/game", "/api/game", "http://127.0.0.1:8080")
+	route.Add(game, NewRule(GET, "/api/game", "/api/game", 0), "http://127.0.0.1:8080", nil)
 
 	//ws
-	route.Add(POST, "/api/swagger", "/api/swagger", "http://127.0.0.1:8081")
+	route.Add(swagger, NewRule(POST, "/api/swagger", "/api/swagger", 0), "http://127.0.0.1:8081", nil)
 
-	ip, path, ok := route.Find(GET, "/api/game/qwq/qwqeq")
+	backend, path, ok := route.Find(newRequest(GET, "", "/api/game/qwq/qwqeq"))
 	if !ok {
 		fmt.Println("api/qwq/qwqeq not found")
 	} else {
-		fmt.Println("proxy ", ip, path)
+		fmt.Println("proxy ", backend.ProxyIp, path)
 	}
 
-	ip, path, ok = route.Find(POST, "/api/swagger/test/ws")
+	backend, path, ok = route.Find(newRequest(POST, "", "/api/swagger/test/ws"))
 	if !ok {
 		fmt.Println("api/qwq/qwqeq not found")
 	} else {
-		fmt.Println("proxy ", ip, path)
+		fmt.Println("proxy ", backend.ProxyIp, path)
 	}
 
-	route.Delete(GET, "/api/game")
-	route.Delete(POST, "/api/swagger")
+	route.Delete(game)
+	route.Delete(swagger)
 
-	ip, path, ok = route.Find(GET, "/api/game/qwq/qwqeq")
+	backend, path, ok = route.Find(newRequest(GET, "", "/api/game/qwq/qwqeq"))
 	if !ok {
 		fmt.Println("api/qwq/qwqeq not found")
 	} else {
-		fmt.Println("proxy ", ip, path)
+		fmt.Println("proxy ", backend.ProxyIp, path)
 	}
 
-	ip, path, ok = route.Find(POST, "/api/swagger/test/ws")
+	backend, path, ok = route.Find(newRequest(POST, "", "/api/swagger/test/ws"))
 	if !ok {
 		fmt.Println("api/qwq/qwqeq not found")
 	} else {
-		fmt.Println("proxy ", ip, path)
+		fmt.Println("proxy ", backend.ProxyIp, path)
+	}
+}
+
+func TestRoutePool(t *testing.T) {
+	route := NewRoute()
+	pod1 := NewOwner("default", KindPod, "game-1", "1")
+	pod2 := NewOwner("default", KindPod, "game-2", "2")
+	route.Add(pod1, NewRule(GET, "/api/game", "/api/game", 0), "http://127.0.0.1:8080", nil)
+	route.Add(pod2, NewRule(GET, "/api/game", "/api/game", 0), "http://127.0.0.1:8081", nil)
+
+	//round robin over both pods
+	seen := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		backend, _, ok := route.Find(newRequest(GET, "", "/api/game/room"))
+		if !ok {
+			t.Fatal("/api/game/room not found")
+		}
+		seen[backend.ProxyIp]++
+	}
+	if seen["http://127.0.0.1:8080"] != 2 || seen["http://127.0.0.1:8081"] != 2 {
+		t.Fatalf("round robin %v", seen)
+	}
+
+	//delete one pod keeps the other
+	route.Delete(pod1)
+	backend, _, ok := route.Find(newRequest(GET, "", "/api/game/room"))
+	if !ok || backend.ProxyIp != "http://127.0.0.1:8081" {
+		t.Fatal("remaining backend not found")
+	}
+
+	//delete last pod removes route
+	route.Delete(pod2)
+	if _, _, ok := route.Find(newRequest(GET, "", "/api/game/room")); ok {
+		t.Fatal("route should be deleted")
+	}
+}
+
+func TestRouteOwner(t *testing.T) {
+	route := NewRoute()
+	api := NewOwner("default", KindService, "api", "1")
+	game := NewOwner("default", KindService, "game", "2")
+	route.Add(api, NewRule(GET, "/api", "/api", 0), "http://10.0.0.1:8080", nil)
+	route.Add(game, NewRule(GET, "/api/game", "/api/game", 0), "http://10.0.0.2:8080", nil)
+
+	//same backend shared by two owners
+	pod := NewOwner("default", KindPod, "game-0", "3")
+	route.Add(pod, NewRule(GET, "/api/game", "/api/game", 0), "http://10.0.0.2:8080", nil)
+
+	//owners by name, a recreated pod has another uid
+	recreated := NewOwner("default", KindPod, "game-0", "4")
+	route.Add(recreated, NewRule(GET, "/api/game", "/api/game", 0), "http://10.0.0.3:8080", nil)
+	if owners := route.OwnersOf("default", KindPod, "game-0"); len(owners) != 2 {
+		t.Fatalf("owners of game-0 %v", owners)
+	}
+	route.Delete(recreated)
+	if owners := route.OwnersOf("default", KindPod, "game-0"); len(owners) != 1 || owners[0] != pod {
+		t.Fatalf("owners of game-0 %v", owners)
+	}
+
+	//removing /api keeps /api/game
+	route.Delete(api)
+	backend, _, ok := route.Find(newRequest(GET, "", "/api/game/room"))
+	if !ok || backend.ProxyIp != "http://10.0.0.2:8080" {
+		t.Fatal("/api/game should survive /api delete")
+	}
+
+	//backend is kept until its last owner goes away
+	route.Delete(game)
+	if _, _, ok := route.Find(newRequest(GET, "", "/api/game/room")); !ok {
+		t.Fatal("/api/game should survive while pod owns it")
+	}
+	route.Delete(pod)
+	if _, _, ok := route.Find(newRequest(GET, "", "/api/game/room")); ok {
+		t.Fatal("/api/game should be deleted")
+	}
+	if len(route.Owners()) != 0 || len(route.OwnersOf("default", KindPod, "game-0")) != 0 {
+		t.Fatalf("owners left %v", route.Owners())
+	}
+}
+
+func TestRouteParams(t *testing.T) {
+	route := NewRoute()
+	owner := NewOwner("default", KindPod, "game-0", "1")
+	route.Add(owner, NewRule(GET, "/room/:roomId/ws", "/ws?room={roomId}", 0), "http://10.0.0.1:8080", nil)
+	route.Add(owner, NewRule(GET, "/room/lobby", "/lobby", 0), "http://10.0.0.1:8080", nil)
+	route.Add(owner, NewRule(GET, "/assets/*path", "/static/{path}", 0), "http://10.0.0.1:8080", nil)
+	route.Add(owner, NewRule(GET, "/api", "/", 0), "http://10.0.0.1:8080", nil)
+
+	tests := []struct {
+		url  string
+		path string
+	}{
+		{"/room/1001/ws", "/ws?room=1001"},
+		{"/room/a b/ws/chat", "/ws/chat?room=a+b"},
+		{"/room/lobby", "/lobby"},
+		{"/room/lobby/", "/lobby/"},
+		{"/assets/img/logo.png", "/static/img/logo.png"},
+		{"/api/game", "/game"},
+	}
+	for _, test := range tests {
+		_, path, ok := route.Find(newRequest(GET, "", test.url))
+		if !ok {
+			t.Fatalf("%s not found", test.url)
+		}
+		if path != test.path {
+			t.Fatalf("%s proxy %s, want %s", test.url, path, test.path)
+		}
+	}
+
+	//param without ws suffix has no backend
+	if _, _, ok := route.Find(newRequest(GET, "", "/room/1001")); ok {
+		t.Fatal("/room/1001 should not match")
+	}
+
+	//wildcard delete
+	route.Delete(owner)
+	if _, _, ok := route.Find(newRequest(GET, "", "/assets/img/logo.png")); ok {
+		t.Fatal("/assets should be deleted")
+	}
+}
+
+func TestRouteRegex(t *testing.T) {
+	route := NewRoute()
+	legacy := NewOwner("default", KindService, "legacy", "1")
+	game := NewOwner("default", KindService, "game", "2")
+
+	rule := NewRule(GET, `/v1/g(\d+)/(?P<action>\w+)`, "/game/{1}/{action}?legacy={1}", 0)
+	rule.Match = Regex
+	if err := route.Add(legacy, rule, "http://10.0.0.1:8080", nil); err != nil {
+		t.Fatal(err)
+	}
+	route.Add(game, NewRule(GET, "/", "/", 0), "http://10.0.0.2:8080", nil)
+
+	//regex wins over the catch all trie route
+	backend, path, ok := route.Find(newRequest(GET, "", "/v1/g12/join/now"))
+	if !ok || backend.ProxyIp != "http://10.0.0.1:8080" {
+		t.Fatal("/v1/g12/join/now should match regex")
 	}
+	if path != "/game/12/join/now?legacy=12" {
+		t.Fatalf("regex proxy %s", path)
+	}
+
+	//anchored at the start of url
+	backend, _, ok = route.Find(newRequest(GET, "", "/x/v1/g12/join"))
+	if !ok || backend.ProxyIp != "http://10.0.0.2:8080" {
+		t.Fatal("/x/v1/g12/join should fall back to trie")
+	}
+
+	//invalid expression
+	rule = NewRule(GET, `/v1/(`, "/", 0)
+	rule.Match = Regex
+	if err := route.Add(legacy, rule, "http://10.0.0.1:8080", nil); err == nil {
+		t.Fatal("invalid regex should fail")
+	}
+
+	route.Delete(legacy)
+	backend, _, ok = route.Find(newRequest(GET, "", "/v1/g12/join"))
+	if !ok || backend.ProxyIp != "http://10.0.0.2:8080" {
+		t.Fatal("regex route should be deleted")
+	}
+}
+
+func TestRouteHost(t *testing.T) {
+	route := NewRoute()
+	owner := NewOwner("default", KindService, "game", "1")
+
+	rule := NewRule(GET, "/api", "/api", 0)
+	rule.Host = "Lobby.Games.Example.com"
+	route.Add(owner, rule, "http://10.0.0.1:8080", nil)
+
+	rule = NewRule(GET, "/api", "/api", 0)
+	rule.Host = "*.games.example.com"
+	route.Add(owner, rule, "http://10.0.0.2:8080", nil)
+
+	route.Add(owner, NewRule(GET, "/", "/", 0), "http://10.0.0.3:8080", nil)
+
+	tests := []struct {
+		host    string
+		url     string
+		proxyIp string
+	}{
+		{"lobby.games.example.com:8080", "/api/join", "http://10.0.0.1:8080"},
+		{"chat.games.example.com", "/api/join", "http://10.0.0.2:8080"},
+		{"a.chat.games.example.com", "/api/join", "http://10.0.0.3:8080"},
+		{"chat.games.example.com", "/index.html", "http://10.0.0.3:8080"},
+		{"", "/api/join", "http://10.0.0.3:8080"},
+	}
+	for _, test := range tests {
+		backend, _, ok := route.Find(newRequest(GET, test.host, test.url))
+		if !ok || backend.ProxyIp != test.proxyIp {
+			t.Fatalf("%s%s should proxy to %s", test.host, test.url, test.proxyIp)
+		}
+	}
+
+	route.Delete(owner)
+	if len(route.load().Hosts) != 0 {
+		t.Fatalf("hosts left %d", len(route.load().Hosts))
+	}
+}
+
+func TestRoutePredicate(t *testing.T) {
+	route := NewRoute()
+	stable := NewOwner("default", KindPod, "game-stable", "1")
+	next := NewOwner("default", KindPod, "game-next", "2")
+	ios := NewOwner("default", KindPod, "game-ios", "3")
+
+	route.Add(stable, NewRule(GET, "/api/game", "/api/game", 0), "http://10.0.0.1:8080", nil)
+
+	rule := NewRule(GET, "/api/game", "/api/game", 0)
+	rule.Headers = []*Condition{NewCondition("x-client-version", GreaterEqual, "2.3")}
+	route.Add(next, rule, "http://10.0.0.2:8080", nil)
+
+	rule = NewRule(GET, "/api/game", "/api/game", 0)
+	rule.Headers = []*Condition{NewCondition("X-Client-Version", GreaterEqual, "2.3")}
+	rule.Query = []*Condition{NewCondition("platform", Equal, "ios")}
+	route.Add(ios, rule, "http://10.0.0.3:8080", nil)
+
+	rule = NewRule(GET, "/api/game", "/api/game", 0)
+	rule.Cookies = []*Condition{NewCondition("beta", "~", "1")}
+	if err := route.Add(ios, rule, "http://10.0.0.3:8080", nil); err == nil {
+		t.Fatal("unknown operator should fail")
+	}
+
+	tests := []struct {
+		version string
+		query   string
+		proxyIp string
+	}{
+		{"", "", "http://10.0.0.1:8080"},
+		{"2.2.9", "", "http://10.0.0.1:8080"},
+		{"2.3", "", "http://10.0.0.2:8080"},
+		{"2.10", "platform=android", "http://10.0.0.2:8080"},
+		{"2.10", "platform=ios", "http://10.0.0.3:8080"},
+		{"1.0", "platform=ios", "http://10.0.0.1:8080"},
+	}
+	for _, test := range tests {
+		req := newRequest(GET, "", "/api/game/join")
+		req.URL.RawQuery = test.query
+		if len(test.version) > 0 {
+			req.Header.Set("X-Client-Version", test.version)
+		}
+		backend, _, ok := route.Find(req)
+		if !ok || backend.ProxyIp != test.proxyIp {
+			t.Fatalf("version %s query %s should proxy to %s", test.version, test.query, test.proxyIp)
+		}
+	}
+
+	//without fallback target the shorter prefix is used
+	route.Delete(stable)
+	route.Add(stable, NewRule(GET, "/api", "/api", 0), "http://10.0.0.1:8080", nil)
+	backend, path, ok := route.Find(newRequest(GET, "", "/api/game/join"))
+	if !ok || backend.ProxyIp != "http://10.0.0.1:8080" || path != "/api/game/join" {
+		t.Fatal("/api/game/join should fall back to /api")
+	}
+}
+
+func TestRouteConsistentHash(t *testing.T) {
+	route := NewRoute()
+	rule := NewRule(GET, "/room/:roomId", "/room/{roomId}", 0)
+	rule.Balance = ConsistentHash
+	if err := route.Add(NewOwner("default", KindPod, "game", "0"), rule, "http://10.0.0.1:8080", nil); err == nil {
+		t.Fatal("consistent hash without hash key should be rejected")
+	}
+	rule.HashKey = &HashKey{Source: HashParam, Name: "roomId"}
+
+	owner := func(i int) Owner {
+		return NewOwner("default", KindPod, fmt.Sprintf("game-%d", i), strconv.Itoa(i))
+	}
+	for i := 0; i < 5; i++ {
+		route.Add(owner(i), rule, fmt.Sprintf("http://10.0.0.%d:8080", i), nil)
+	}
+	pick := func() map[string]string {
+		picks := make(map[string]string)
+		for room := 0; room < 1000; room++ {
+			url := fmt.Sprintf("/room/%d", room)
+			backend, _, ok := route.Find(newRequest(GET, "", url))
+			if !ok {
+				t.Fatalf("%s not found", url)
+			}
+			picks[url] = backend.ProxyIp
+		}
+		return picks
+	}
+
+	//same room always lands on the same pod
+	before := pick()
+	for url, proxyIp := range pick() {
+		if before[url] != proxyIp {
+			t.Fatalf("%s moved from %s to %s", url, before[url], proxyIp)
+		}
+	}
+
+	//one pod leaving only moves its own rooms
+	route.Delete(owner(4))
+	for url, proxyIp := range pick() {
+		if before[url] != proxyIp && before[url] != "http://10.0.0.4:8080" {
+			t.Fatalf("%s moved from %s to %s", url, before[url], proxyIp)
+		}
+	}
+
+	//one pod joining only takes rooms
+	route.Add(owner(4), rule, "http://10.0.0.4:8080", nil)
+	for url, proxyIp := range pick() {
+		if before[url] != proxyIp {
+			t.Fatalf("%s moved from %s to %s", url, before[url], proxyIp)
+		}
+	}
+}
+
+func TestRouteDraining(t *testing.T) {
+	route := NewRoute()
+	rule := NewRule(GET, "/room/:roomId", "/room/{roomId}", 0)
+	rule.Balance = ConsistentHash
+	rule.HashKey = &HashKey{Source: HashQuery, Name: "roomId"}
+
+	owner := func(i int) Owner {
+		return NewOwner("default", KindPod, fmt.Sprintf("game-%d", i), strconv.Itoa(i))
+	}
+	register := func(i int, draining bool) {
+		registration := NewRegistration(rule, fmt.Sprintf("http://10.0.0.%d:8080", i), nil)
+		registration.Draining = draining
+		if err := route.Replace(owner(i), []*Registration{registration}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		register(i, false)
+	}
+	pick := func(query string) string {
+		req := newRequest(GET, "", "/room/1")
+		req.URL.RawQuery = query
+		backend, _, ok := route.Find(req)
+		if !ok {
+			t.Fatalf("%s not found", query)
+		}
+		return backend.ProxyIp
+	}
+	before := make(map[string]string)
+	for room := 0; room < 300; room++ {
+		query := fmt.Sprintf("roomId=%d", room)
+		before[query] = pick(query)
+	}
+
+	//rooms of the draining pod stay, other rooms do not move
+	register(2, true)
+	for query, proxyIp := range before {
+		if after := pick(query); after != proxyIp {
+			t.Fatalf("%s moved from %s to %s", query, proxyIp, after)
+		}
+	}
+
+	//requests without room only go to the other pods
+	for i := 0; i < 100; i++ {
+		if proxyIp := pick(""); proxyIp == "http://10.0.0.2:8080" {
+			t.Fatal("draining pod picked without hash key")
+		}
+	}
+
+	//draining pods serve when no other pod is left
+	register(0, true)
+	register(1, true)
+	if proxyIp := pick(""); len(proxyIp) <= 0 {
+		t.Fatal("draining pods not picked")
+	}
+
+	//snapshot keeps draining
+	restored := NewRoute()
+	restored.Restore(route.Snapshot())
+	for _, o := range restored.Snapshot().Owners {
+		if !o.Entries[0].Draining {
+			t.Fatalf("%s restored not draining", o.Owner)
+		}
+	}
+}
+
+func TestRouteSplit(t *testing.T) {
+	route := NewRoute()
+	stable := map[string]string{"track": "stable"}
+	canary := map[string]string{"track": "canary"}
+	rule := NewRule(GET, "/api/game", "/api/game", 0)
+	rule.Split = []*Split{{Labels: canary, Weight: 5}}
+	route.Add(NewOwner("default", KindPod, "game-1", "1"), rule, "http://10.0.0.1:8080", stable)
+	route.Add(NewOwner("default", KindPod, "game-2", "2"), rule, "http://10.0.0.2:8080", stable)
+	route.Add(NewOwner("default", KindPod, "game-3", "3"), rule, "http://10.0.0.3:8080", canary)
+
+	count := func() int {
+		hits := 0
+		for i := 0; i < 10000; i++ {
+			backend, _, ok := route.Find(newRequest(GET, "", "/api/game"))
+			if !ok {
+				t.Fatal("/api/game not found")
+			}
+			if backend.ProxyIp == "http://10.0.0.3:8080" {
+				hits++
+			}
+		}
+		return hits
+	}
+
+	//about 5% to canary
+	if hits := count(); hits < 300 || hits > 700 {
+		t.Fatalf("canary got %d of 10000", hits)
+	}
+
+	//weight changed by the annotation only
+	rule.Split = []*Split{{Labels: canary, Weight: 50}}
+	route.Add(NewOwner("default", KindPod, "game-1", "1"), rule, "http://10.0.0.1:8080", stable)
+	if hits := count(); hits < 4500 || hits > 5500 {
+		t.Fatalf("canary got %d of 10000", hits)
+	}
+
+	//weights over 100 are rejected
+	rule.Split = []*Split{{Labels: canary, Weight: 60}, {Labels: stable, Weight: 60}}
+	if err := route.Add(NewOwner("default", KindPod, "game-1", "1"), rule, "http://10.0.0.1:8080", stable); err == nil {
+		t.Fatal("split over 100 should be rejected")
+	}
+}
+
+func TestRouteSplitConflicts(t *testing.T) {
+	stable := map[string]string{"track": "stable"}
+	canary := map[string]string{"track": "canary"}
+	split := NewRule(GET, "/api/game", "/api/game", 0)
+	split.Split = []*Split{{Labels: canary, Weight: 10}}
+	plain := NewRule(GET, "/api/game", "/api/game", 0)
+	game1 := NewOwner("default", KindPod, "game-1", "1")
+	game2 := NewOwner("default", KindPod, "game-2", "2")
+	game3 := NewOwner("default", KindPod, "game-3", "3")
+
+	count := func(route *Route) int {
+		hits := 0
+		for i := 0; i < 10000; i++ {
+			backend, _, ok := route.Find(newRequest(GET, "", "/api/game"))
+			if !ok {
+				t.Fatal("/api/game not found")
+			}
+			if backend.ProxyIp == "http://10.0.0.3:8080" {
+				hits++
+			}
+		}
+		return hits
+	}
+
+	//split of the first owner whatever the registration order
+	forward := NewRoute()
+	forward.Add(game1, split, "http://10.0.0.1:8080", stable)
+	forward.Add(game2, plain, "http://10.0.0.2:8080", stable)
+	forward.Add(game3, plain, "http://10.0.0.3:8080", canary)
+	backward := NewRoute()
+	backward.Add(game3, plain, "http://10.0.0.3:8080", canary)
+	backward.Add(game2, plain, "http://10.0.0.2:8080", stable)
+	backward.Add(game1, split, "http://10.0.0.1:8080", stable)
+	for _, route := range []*Route{forward, backward} {
+		if hits := count(route); hits < 700 || hits > 1300 {
+			t.Fatalf("canary got %d of 10000", hits)
+		}
+
+		//other split is a conflict
+		conflicts := route.Conflicts(game2)
+		if len(conflicts) != 1 || conflicts[0].Owner != game1 {
+			t.Fatalf("conflicts %v", conflicts)
+		}
+	}
+
+	//one owner with two splits of a location is rejected
+	route := NewRoute()
+	err := route.Replace(game1, []*Registration{
+		NewRegistration(split, "http://10.0.0.1:8080", stable),
+		NewRegistration(plain, "http://10.0.0.3:8080", canary),
+	})
+	if err == nil {
+		t.Fatal("conflicting splits of one owner should be rejected")
+	}
+	if hits := count(route); hits != 0 {
+		t.Fatalf("rejected backend got %d of 10000", hits)
+	}
+}
+
+func TestRouteMirror(t *testing.T) {
+	route := NewRoute()
+	live := NewOwner("default", KindPod, "match-1", "1")
+	shadow := NewOwner("default", KindPod, "match-next", "2")
+	rule := NewRule(GET, "/api/match", "/api/match", 0)
+	route.Add(live, rule, "http://10.0.0.1:8080", nil)
+
+	mirror := NewRule(GET, "/api/match", "/api/match", 0)
+	mirror.Mirror = &Mirror{Percent: 100}
+	route.Add(shadow, mirror, "http://10.0.0.2:8080", nil)
+
+	//shadow backend only gets copies
+	for i := 0; i < 10; i++ {
+		result, ok := route.Lookup(newRequest(GET, "", "/api/match"))
+		if !ok || result.Backend.ProxyIp != "http://10.0.0.1:8080" {
+			t.Fatal("/api/match should proxy to live backend")
+		}
+		if result.Mirror == nil || result.Mirror.ProxyIp != "http://10.0.0.2:8080" {
+			t.Fatal("/api/match should be mirrored")
+		}
+	}
+
+	//percent caps copies
+	mirror.Mirror = &Mirror{Percent: 0}
+	route.Add(shadow, mirror, "http://10.0.0.2:8080", nil)
+	if result, ok := route.Lookup(newRequest(GET, "", "/api/match")); !ok || result.Mirror != nil {
+		t.Fatal("/api/match should not be mirrored")
+	}
+
+	//shadow backend alone does not serve
+	route.Delete(live)
+	if _, ok := route.Lookup(newRequest(GET, "", "/api/match")); ok {
+		t.Fatal("/api/match without live backend should not be found")
+	}
+}
+
+func TestRouteSnapshot(t *testing.T) {
+	route := NewRoute()
+	game := NewOwner("default", KindPod, "game", "1")
+	lobby := NewOwner("default", KindPod, "lobby", "2")
+	route.Add(game, NewRule(GET, "/api/game", "/api/game", 0), "http://10.0.0.1:8080", nil)
+	route.Add(game, NewRule(GET, "/api/old", "/api/old", 0), "http://10.0.0.1:8080", nil)
+	route.Add(lobby, NewRule(GET, "/api/lobby", "/api/lobby", 0), "http://10.0.0.2:8080", nil)
+
+	path := filepath.Join(t.TempDir(), "route.json")
+	if err := WriteSnapshot(path, route.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := ReadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//warm start serves the snapshot
+	route = NewRoute()
+	route.Restore(snapshot)
+	for _, url := range []string{"/api/game", "/api/old", "/api/lobby"} {
+		if _, _, ok := route.Find(newRequest(GET, "", url)); !ok {
+			t.Fatalf("%s not restored", url)
+		}
+	}
+
+	//reconcile keeps only registered entries
+	route.Add(game, NewRule(GET, "/api/game", "/api/game", 0), "http://10.0.0.1:8080", nil)
+	route.Sweep()
+	if _, _, ok := route.Find(newRequest(GET, "", "/api/game")); !ok {
+		t.Fatal("/api/game should be kept")
+	}
+	for _, url := range []string{"/api/old", "/api/lobby"} {
+		if _, _, ok := route.Find(newRequest(GET, "", url)); ok {
+			t.Fatalf("%s should be swept", url)
+		}
+	}
+	if len(route.Owners()) != 1 || len(route.OwnersOf(lobby.Namespace, lobby.Kind, lobby.Name)) != 0 {
+		t.Fatalf("owners %v", route.Owners())
+	}
+
+	//unknown version
+	ioutil.WriteFile(path, []byte(`{"Version":99}`), 0644)
+	if _, err := ReadSnapshot(path); err == nil {
+		t.Fatal("snapshot version 99 should be rejected")
+	}
+}
+
+func TestRouteRewrite(t *testing.T) {
+	route := NewRoute()
+	owner := NewOwner("default", KindPod, "game", "1")
+	route.Add(owner, NewRule(GET, "/files/*name", "/store/{name}?v=1", 0), "http://10.0.0.1:8080", nil)
+	route.Add(owner, NewRule(GET, "/room/:roomId", "/room/{roomId}", 0), "http://10.0.0.1:8080", nil)
+	route.Add(owner, NewRule(GET, "/", "/", 0), "http://10.0.0.1:8080", nil)
+
+	strip := NewRule(GET, "/api", "", 0)
+	strip.Rewrite = &Rewrite{StripPrefix: "/api", AddPrefix: "/v2", AddQuery: map[string]string{"from": "proxy"}, RemoveQuery: []string{"token"}}
+	route.Add(owner, strip, "http://10.0.0.1:8080", nil)
+
+	template := NewRule(GET, "/match/:roomId", "", 0)
+	template.Rewrite = &Rewrite{StripPrefix: "/match", Template: "/game{path}?room={roomId}&{query}"}
+	route.Add(owner, template, "http://10.0.0.1:8080", nil)
+
+	tests := []struct {
+		url      string
+		path     string
+		rawQuery string
+	}{
+		{"/files/a%2Fb/c%20d?x=1", "/store/a%2Fb/c%20d", "v=1&x=1"},
+		{"/room/a%2Fb", "/room/a%2Fb", ""},
+		{"/", "/", ""},
+		{"/lobby/", "/lobby/", ""},
+		{"/api/game/a%2Fb?token=1&x=2", "/v2/game/a%2Fb", "from=proxy&x=2"},
+		{"/api", "/v2/", "from=proxy"},
+		{"/match/r%201?x=1", "/game/r%201", "room=r+1&x=1"},
+		{"/match/1001", "/game/1001", "room=1001"},
+	}
+	for _, test := range tests {
+		req := newRequest(GET, "", "")
+		req.URL, _ = url.Parse(test.url)
+		result, ok := route.Lookup(req)
+		if !ok {
+			t.Fatalf("%s not found", test.url)
+		}
+		if result.Path != test.path || result.RawQuery != test.rawQuery {
+			t.Fatalf("%s proxy %s?%s, want %s?%s", test.url, result.Path, result.RawQuery, test.path, test.rawQuery)
+		}
+	}
+
+	//rewrite prefix must be a path
+	bad := NewRule(GET, "/bad", "", 0)
+	bad.Rewrite = &Rewrite{StripPrefix: "bad"}
+	if err := route.Add(owner, bad, "http://10.0.0.1:8080", nil); err == nil {
+		t.Fatal("strip prefix without / should be rejected")
+	}
+}
+
+func TestRouteStatic(t *testing.T) {
+	yaml := `
+Items:
+- Method: GET
+  AgentUrl: /docs
+  ProxyUrl: /
+  Rewrite:
+    StripPrefix: /docs
+    Host: docs.example.com
+  Backends:
+  - https://docs.example.com
+- Methods: [GET, POST]
+  AgentUrl: /legacy
+  ProxyUrl: /api
+  Backends:
+  - http://10.0.1.1:8080
+  - http://10.0.1.2:8080
+`
+	rules, err := ParseStatic([]byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	route := NewRoute()
+	owner := NewOwner("kube-system", KindStatic, "kubegames-proxy/routes.yaml", "1")
+	if err := route.Replace(owner, rules.Registrations()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := newRequest(GET, "games.example.com", "")
+	req.URL, _ = url.Parse("/docs/guide?page=2")
+	result, ok := route.Lookup(req)
+	if !ok || result.Backend.ProxyIp != "https://docs.example.com" || result.Path != "/guide" || result.RawQuery != "page=2" || result.Host != "docs.example.com" {
+		t.Fatalf("static docs %+v", result)
+	}
+	backends := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		backend, path, ok := route.Find(newRequest(POST, "", "/legacy/room"))
+		if !ok || path != "/api/room" {
+			t.Fatalf("static legacy %v %s", ok, path)
+		}
+		backends[backend.ProxyIp] = true
+	}
+	if len(backends) != 2 {
+		t.Fatalf("static backends %v", backends)
+	}
+
+	tests := []string{
+		`{"Items":[{"Method":"GET","AgentUrl":"/docs","ProxyUrl":"/"}]}`,
+		`{"Items":[{"Method":"GET","AgentUrl":"/docs","ProxyUrl":"/","Backends":["docs.example.com"]}]}`,
+		`{"Items":[{"Method":"GET","AgentUrl":"/docs","ProxyUrl":"/","Backends":["ftp://docs.example.com"]}]}`,
+		`{"Items":[{"Method":"GET","AgentUrl":"/docs","ProxyUrl":"/","Backends":["https://docs.example.com"],"Backend":1}]}`,
+		`{"Items":[]}`,
+	}
+	for _, test := range tests {
+		if _, err := ParseStatic([]byte(test)); err == nil {
+			t.Fatalf("%s should be rejected", test)
+		}
+	}
+}
+
+func TestRouteReplace(t *testing.T) {
+	route := NewRoute()
+	owner := NewOwner("default", KindPod, "game", "1")
+	route.Replace(owner, []*Registration{
+		NewRegistration(NewRule(GET, "/api/a", "/a", 0), "http://10.0.0.1:8080", nil),
+		NewRegistration(NewRule(GET, "/api/b", "/b", 0), "http://10.0.0.1:8080", nil),
+	})
+
+	//one commit for the whole set
+	version := route.Version()
+	bad := NewRule(GET, "/api/bad", "/bad", 0)
+	bad.Match = Regex
+	bad.AgentUrl = "/api/(bad"
+	err := route.Replace(owner, []*Registration{
+		NewRegistration(NewRule(GET, "/api/b", "/b2", 0), "http://10.0.0.1:8080", nil),
+		NewRegistration(NewRule(GET, "/api/c", "/c", 0), "http://10.0.0.1:8080", nil),
+		NewRegistration(bad, "http://10.0.0.1:8080", nil),
+	})
+	if err == nil {
+		t.Fatal("invalid regex should be reported")
+	}
+	if route.Version() != version+1 {
+		t.Fatalf("replace committed %d times", route.Version()-version)
+	}
+
+	tests := []struct {
+		url  string
+		path string
+		ok   bool
+	}{
+		{"/api/a", "", false},
+		{"/api/b", "/b2", true},
+		{"/api/c", "/c", true},
+	}
+	for _, test := range tests {
+		_, path, ok := route.Find(newRequest(GET, "", test.url))
+		if ok != test.ok || path != test.path {
+			t.Fatalf("%s proxy %s %v", test.url, path, ok)
+		}
+	}
+
+	//unchanged set does not commit
+	version = route.Version()
+	route.Replace(owner, []*Registration{
+		NewRegistration(NewRule(GET, "/api/b", "/b2", 0), "http://10.0.0.1:8080", nil),
+		NewRegistration(NewRule(GET, "/api/c", "/c", 0), "http://10.0.0.1:8080", nil),
+	})
+	if route.Version() != version {
+		t.Fatal("unchanged replace should not commit")
+	}
+
+	//empty set deletes owner
+	route.Replace(owner, nil)
+	if len(route.Owners()) != 0 {
+		t.Fatal("owner should be deleted")
+	}
+}
+
+func TestRouteMethods(t *testing.T) {
+	route := NewRoute()
+	owner := NewOwner("default", KindPod, "game", "1")
+	rule := NewRule("", "/api/room/:roomId", "/room/{roomId}", 0)
+	rule.Methods = []Method{GET, "post"}
+	route.Add(owner, rule, "http://10.0.0.1:8080", nil)
+	route.Add(owner, NewRule(DELETE, "/api/room/:id", "/delete/{id}", 0), "http://10.0.0.2:8080", nil)
+
+	tests := []struct {
+		method  Method
+		proxyIp string
+		path    string
+	}{
+		{GET, "http://10.0.0.1:8080", "/room/1001"},
+		{POST, "http://10.0.0.1:8080", "/room/1001"},
+		{DELETE, "http://10.0.0.2:8080", "/delete/1001"},
+	}
+	for _, test := range tests {
+		backend, path, ok := route.Find(newRequest(test.method, "", "/api/room/1001"))
+		if !ok || backend.ProxyIp != test.proxyIp || path != test.path {
+			t.Fatalf("%s /api/room/1001 should proxy to %s%s", test.method, test.proxyIp, test.path)
+		}
+	}
+
+	//path matches without method
+	if _, _, ok := route.Find(newRequest(PUT, "", "/api/room/1001")); ok {
+		t.Fatal("PUT /api/room/1001 should not be found")
+	}
+	if allow := fmt.Sprint(route.Allow(newRequest(PUT, "", "/api/room/1001"))); allow != "[GET POST DELETE]" {
+		t.Fatalf("allow %s", allow)
+	}
+	if allow := route.Allow(newRequest(PUT, "", "/api/lobby")); len(allow) != 0 {
+		t.Fatalf("allow %v", allow)
+	}
+
+	//any is every method
+	route.Add(owner, NewRule(Any, "/api/lobby", "/lobby", 0), "http://10.0.0.1:8080", nil)
+	if allow := route.Allow(newRequest(PUT, "", "/api/lobby")); len(allow) != 9 {
+		t.Fatalf("allow %v", allow)
+	}
+
+	//unknown method
+	if err := route.Add(owner, NewRule("FETCH", "/api", "/api", 0), "http://10.0.0.1:8080", nil); err == nil {
+		t.Fatal("unknown method should be rejected")
+	}
+}
+
+func TestRouteConflicts(t *testing.T) {
+	route := NewRoute()
+	game1 := NewOwner("default", KindPod, "game-1", "1")
+	game2 := NewOwner("default", KindPod, "game-2", "2")
+	route.Add(game1, NewRule(GET, "/api/game", "/api/game", 0), "http://10.0.0.1:8080", nil)
+	route.Add(game2, NewRule(GET, "/api/game", "/api/game", 0), "http://10.0.0.2:8080", nil)
+	if conflicts := route.Conflicts(game2); len(conflicts) != 0 {
+		t.Fatalf("conflicts %v", conflicts)
+	}
+
+	//same agent url to another proxy url
+	route.Add(game2, NewRule(GET, "/api/game", "/v2/game", 0), "http://10.0.0.2:8080", nil)
+	conflicts := route.Conflicts(game2)
+	if len(conflicts) != 1 || conflicts[0].Owner != game1 {
+		t.Fatalf("conflicts %v", conflicts)
+	}
+}
+
+//route with one room route registered by each game pod
+func benchmarkRoute(games int) *Route {
+	log.SetLevel(log.InfoLevel)
+	route := NewRoute()
+	for i := 0; i < games; i++ {
+		owner := NewOwner("default", KindPod, fmt.Sprintf("game-%d", i), fmt.Sprint(i))
+		agentUrl := fmt.Sprintf("/game/%d/room/:roomId", i)
+		route.Add(owner, NewRule(GET, agentUrl, "/room/{roomId}", 8080), fmt.Sprintf("http://10.0.%d.%d:8080", i/250, i%250), nil)
+	}
+	return route
+}
+
+func BenchmarkFind(b *testing.B) {
+	route := benchmarkRoute(1000)
+	req := newRequest(GET, "", "/game/500/room/1001/ws")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, ok := route.Find(req); !ok {
+			b.Fatal("not found")
+		}
+	}
+}
+
+func BenchmarkFindParallel(b *testing.B) {
+	route := benchmarkRoute(1000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		req := newRequest(GET, "", "/game/500/room/1001/ws")
+		for pb.Next() {
+			if _, _, ok := route.Find(req); !ok {
+				b.Fatal("not found")
+			}
+		}
+	})
+}
+
+//lookups while a writer keeps adding and deleting pods
+func BenchmarkFindParallelWithUpdates(b *testing.B) {
+	route := benchmarkRoute(1000)
+
+	done := make(chan struct{})
+	updated := make(chan int)
+	go func() {
+		updates := 0
+		defer func() { updated <- updates }()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			owner := NewOwner("default", KindPod, "churn", fmt.Sprint(updates))
+			route.Add(owner, NewRule(GET, "/churn/:id", "/{id}", 8080), "http://10.1.0.1:8080", nil)
+			route.Delete(owner)
+			updates++
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	b.RunParallel(func(pb *testing.PB) {
+		req := newRequest(GET, "", "/game/500/room/1001/ws")
+		for pb.Next() {
+			if _, _, ok := route.Find(req); !ok {
+				b.Fatal("not found")
+			}
+		}
+	})
+	b.StopTimer()
+
+	close(done)
+	b.ReportMetric(float64(<-updated)/time.Since(start).Seconds(), "updates/s")
 }
@@ -3,6 +3,12 @@ package route
 import (
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -18,8 +24,22 @@ const (
 	Any     Method       = "Any"
 	Pod     ProxyPattern = "Pod"
 	Service ProxyPattern = "Service"
+
+	//balance
+	RoundRobin     Balance = "RoundRobin"
+	Random         Balance = "Random"
+	LeastRequest   Balance = "LeastRequest"
+	PowerOfTwo     Balance = "PowerOfTwo"
+	ConsistentHash Balance = "ConsistentHash"
+
+	//match, regex rules are tried before prefix rules
+	Prefix Match = "Prefix"
+	Regex  Match = "Regex"
 )
 
+//methods registered by Any in Allow order
+var methods = []Method{GET, HEAD, POST, PUT, PATCH, DELETE, CONNECT, OPTIONS, TRACE}
+
 type (
 	//method
 	Method string
@@ -27,23 +47,58 @@ type (
 	//proxy pattern
 	ProxyPattern string
 
-	//rule
+	//load balancing strategy
+	Balance string
+
+	//agent url match type
+	Match string
+
+	//rule, keys are camel case like the kubernetes resources and are
+	//matched case insensitively so PascalCase keys decode too
 	Rule struct {
 		//proxy method (post delete get ......)
-		Method Method
+		Method Method `json:"method"`
+		//proxy methods, used instead of Method when set
+		Methods []Method `json:"methods,omitempty"`
 		//proxy url (/api/ ....)
-		AgentUrl string
+		AgentUrl string `json:"agentUrl"`
 		//proxy url
-		ProxyUrl string
-		//port
-		Port int64
+		ProxyUrl string `json:"proxyUrl"`
+		//port number or port name (http-game), a name is resolved by
+		//the pod container ports or the service ports and target ports
+		Port intstr.IntOrString `json:"port"`
+		//load balancing strategy between backends (default RoundRobin)
+		Balance Balance `json:"balance,omitempty"`
+		//request key hashed by ConsistentHash balance (header roomId,
+		//param roomId ...), requests without the key are spread randomly
+		HashKey *HashKey `json:"hashKey,omitempty"`
+		//weighted split between backends by labels (5% to track=canary),
+		//owners of an agent url with another split are conflicts and the
+		//split of the first owner by namespace, kind and name is used
+		Split []*Split `json:"split,omitempty"`
+		//register backends of this rule as shadow backends, they get
+		//a copy of Percent of the requests and their responses are dropped
+		Mirror *Mirror `json:"mirror,omitempty"`
+		//rewrite of the request url, ProxyUrl is not used when set
+		Rewrite *Rewrite `json:"rewrite,omitempty"`
+		//agent url match type (default Prefix), a Regex agent url
+		//captures groups used as {1} or {name} in proxy url
+		Match Match `json:"match,omitempty"`
+		//request host (games.example.com or *.games.example.com),
+		//empty for the default host
+		Host string `json:"host,omitempty"`
+		//request conditions, rules sharing an agent url are chosen
+		//by them, most conditions first
+		Headers []*Condition `json:"headers,omitempty"`
+		Cookies []*Condition `json:"cookies,omitempty"`
+		Query   []*Condition `json:"query,omitempty"`
 	}
 
 	//rules
 	Rules struct {
 		//proxy pattern
-		ProxyPattern ProxyPattern
-		Items        []*Rule
+		ProxyPattern ProxyPattern `json:"proxyPattern"`
+		Items        []*Rule      `json:"items"`
 	}
 )
 
@@ -75,6 +130,40 @@ func Unmarshal(str string) (*Rules, error) {
 	return r, nil
 }
 
+//parse plain json or yaml rules, unknown fields are rejected and
+//every rule is validated
+func Parse(data []byte) (*Rules, error) {
+	r := new(Rules)
+	if err := yaml.UnmarshalStrict(data, r); err != nil {
+		return nil, err
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//check proxy pattern and rules
+func (r *Rules) Validate() error {
+	switch r.ProxyPattern {
+	case Pod, Service:
+	default:
+		return fmt.Errorf("unknown proxy pattern %q", r.ProxyPattern)
+	}
+	if len(r.Items) <= 0 {
+		return fmt.Errorf("rules is empty")
+	}
+	for index, rule := range r.Items {
+		if rule == nil {
+			return fmt.Errorf("rule %d is empty", index)
+		}
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func NewRules(proxyPattern ProxyPattern, rules ...*Rule) *Rules {
 	r := new(Rules)
 	r.ProxyPattern = proxyPattern
@@ -90,6 +179,139 @@ func NewRule(method Method, agentUrl, proxyUrl string, port int64) *Rule {
 		Method:   method,
 		AgentUrl: agentUrl,
 		ProxyUrl: proxyUrl,
-		Port:     port,
+		Port:     intstr.FromInt(int(port)),
+	}
+}
+
+//methods of rule in Allow order, Methods or else Method,
+//Any is every method
+func (r *Rule) MethodSet() ([]Method, error) {
+	list := r.Methods
+	if len(list) <= 0 {
+		list = []Method{r.Method}
+	}
+
+	set := make(map[Method]bool, len(list))
+	for _, method := range list {
+		if method == Any {
+			for _, m := range methods {
+				set[m] = true
+			}
+			continue
+		}
+		method = Method(strings.ToUpper(string(method)))
+		if !isMethod(method) {
+			return nil, fmt.Errorf("unknown method %q", method)
+		}
+		set[method] = true
+	}
+
+	result := make([]Method, 0, len(set))
+	for _, method := range methods {
+		if set[method] {
+			result = append(result, method)
+		}
+	}
+	return result, nil
+}
+
+//check rule strictly, the table accepts rules passing validate,
+//annotations must also have a port in range and absolute urls
+func (r *Rule) Validate() error {
+	switch r.Port.Type {
+	case intstr.String:
+		if errs := validation.IsValidPortName(r.Port.StrVal); len(errs) > 0 {
+			return fmt.Errorf("rule %s port %q %s", r.AgentUrl, r.Port.StrVal, strings.Join(errs, ", "))
+		}
+	default:
+		if r.Port.IntVal <= 0 || r.Port.IntVal > 65535 {
+			return fmt.Errorf("rule %s port %d out of range", r.AgentUrl, r.Port.IntVal)
+		}
+	}
+	return r.validateUrls()
+}
+
+//check rule of a backend with a resolved port (http route and ingress
+//backends), the port of the rule is not used
+func (r *Rule) ValidateResolved() error {
+	return r.validateUrls()
+}
+
+//check agent and proxy urls are absolute and the rule options
+func (r *Rule) validateUrls() error {
+	switch {
+	case r.Match == Regex && !strings.HasPrefix(r.AgentUrl, "/") && !strings.HasPrefix(r.AgentUrl, "^/"):
+		return fmt.Errorf("rule agent url %s should start with / or ^/", r.AgentUrl)
+	case r.Match != Regex && !strings.HasPrefix(r.AgentUrl, "/"):
+		return fmt.Errorf("rule agent url %s should start with /", r.AgentUrl)
+	}
+	if r.Rewrite == nil && !strings.HasPrefix(r.ProxyUrl, "/") {
+		return fmt.Errorf("rule %s proxy url %s should start with /", r.AgentUrl, r.ProxyUrl)
+	}
+	if err := r.validate(); err != nil {
+		return fmt.Errorf("rule %s %s", r.AgentUrl, err.Error())
+	}
+	return nil
+}
+
+//check the options the table depends on
+func (r *Rule) validate() error {
+	if _, err := r.MethodSet(); err != nil {
+		return err
+	}
+	switch r.Match {
+	case "", Prefix, Regex:
+	default:
+		return fmt.Errorf("unknown match %s", r.Match)
+	}
+	switch r.Balance {
+	case "", RoundRobin, Random, LeastRequest, PowerOfTwo, ConsistentHash:
+	default:
+		return fmt.Errorf("unknown balance %s", r.Balance)
+	}
+	predicate := r.Predicate()
+	if err := predicate.Validate(); err != nil {
+		return err
+	}
+	if r.Balance == ConsistentHash && r.HashKey == nil {
+		return fmt.Errorf("%s balance without hash key", ConsistentHash)
+	}
+	if r.HashKey != nil {
+		if err := r.HashKey.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateSplits(r.Split); err != nil {
+		return err
+	}
+	if r.Mirror != nil {
+		if err := r.Mirror.Validate(); err != nil {
+			return err
+		}
+	}
+	if r.Rewrite != nil {
+		if err := r.Rewrite.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//request conditions
+func (r *Rule) Predicate() Predicate {
+	return Predicate{
+		Headers: r.Headers,
+		Cookies: r.Cookies,
+		Query:   r.Query,
+	}
+}
+
+//known method
+func isMethod(method Method) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
 	}
+	return false
 }
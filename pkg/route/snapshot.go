@@ -0,0 +1,145 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kubegames/kubegames-proxy/internal/pkg/log"
+)
+
+//snapshot file format version
+const SnapshotVersion = 1
+
+type (
+	//route table snapshot, the registered entries of every owner
+	Snapshot struct {
+		Version int
+		Time    time.Time
+		Owners  []*OwnerSnapshot
+	}
+
+	//entries of one owner
+	OwnerSnapshot struct {
+		Owner   Owner
+		Entries []*Registration
+	}
+)
+
+//snapshot of registered entries
+func (r *Route) Snapshot() *Snapshot {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s := &Snapshot{
+		Version: SnapshotVersion,
+		Time:    time.Now(),
+	}
+	for owner, entries := range r.owners {
+		o := &OwnerSnapshot{Owner: owner}
+		for _, e := range entries {
+			registration := NewRegistration(e.Rule, e.ProxyIp, e.Labels)
+			registration.Draining = e.Draining
+			o.Entries = append(o.Entries, registration)
+		}
+		s.Owners = append(s.Owners, o)
+	}
+	return s
+}
+
+//restore entries of snapshot in one step, restored entries are kept
+//until they are registered again or removed by Sweep
+func (r *Route) Restore(s *Snapshot) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	affected := make(map[*location]bool)
+	for _, o := range s.Owners {
+		for _, es := range o.Entries {
+			e, err := newEntry(es.Rule, es.ProxyIp, es.Labels)
+			if err != nil {
+				log.Warnf("restore proxy %s %s err %s", o.Owner, es.Rule.AgentUrl, err.Error())
+				continue
+			}
+			e.Draining = es.Draining
+			e.restored = true
+			r.add(o.Owner, e, affected)
+		}
+	}
+	r.commit(affected)
+	log.Infof("restore %d owners of snapshot %s", len(s.Owners), s.Time.Format(time.RFC3339))
+}
+
+//remove restored entries not registered again
+func (r *Route) Sweep() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	affected := make(map[*location]bool)
+	for owner, entries := range r.owners {
+		next := entries[:0:0]
+		for _, e := range entries {
+			if e.restored {
+				r.unlink(e, affected)
+				continue
+			}
+			next = append(next, e)
+		}
+		r.setOwner(owner, next)
+	}
+	r.commit(affected)
+}
+
+//changes committed since the route was created
+func (r *Route) Version() uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.version
+}
+
+//write snapshot file, the file is replaced atomically
+func WriteSnapshot(path string, s *Snapshot) error {
+	buff, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(buff); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+//read snapshot file
+func ReadSnapshot(path string) (*Snapshot, error) {
+	buff, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(Snapshot)
+	if err := json.Unmarshal(buff, s); err != nil {
+		return nil, err
+	}
+	if s.Version != SnapshotVersion {
+		return nil, fmt.Errorf("snapshot %s version %d not supported", path, s.Version)
+	}
+	return s, nil
+}
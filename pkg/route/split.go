@@ -0,0 +1,130 @@
+package route
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+//total weight of splits in percent
+const splitTotal = 100
+
+type (
+	//weighted share of traffic sent to backends selected by labels,
+	//backends selected by no split share the rest
+	Split struct {
+		//backend labels (track: canary)
+		Labels map[string]string `json:"labels"`
+		//percent of traffic
+		Weight int64 `json:"weight"`
+	}
+
+	//backends of one split
+	subset struct {
+		Weight   int64
+		Backends []*Backend
+		Balancer Balancer
+	}
+)
+
+//check split
+func (s *Split) Validate() error {
+	if len(s.Labels) <= 0 {
+		return fmt.Errorf("split labels is empty")
+	}
+	if s.Weight < 0 || s.Weight > splitTotal {
+		return fmt.Errorf("split %v weight %d out of range", s.Labels, s.Weight)
+	}
+	return nil
+}
+
+//backend labels selected by split
+func (s *Split) Selects(labels map[string]string) bool {
+	for name, value := range s.Labels {
+		if v, ok := labels[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+//check splits of rule
+func validateSplits(splits []*Split) error {
+	var total int64
+	for _, split := range splits {
+		if err := split.Validate(); err != nil {
+			return err
+		}
+		total += split.Weight
+	}
+	if total > splitTotal {
+		return fmt.Errorf("split weight %d over %d", total, splitTotal)
+	}
+	return nil
+}
+
+//group backends of entries by the splits of target
+func (t *Target) split(splits []*Split, entries []*entry, backends map[string]*Backend) {
+	if len(splits) <= 0 {
+		return
+	}
+
+	//rest of traffic for backends selected by no split
+	rest := &subset{Weight: splitTotal}
+	subsets := make([]*subset, len(splits))
+	for index, split := range splits {
+		subsets[index] = &subset{Weight: split.Weight}
+		rest.Weight -= split.Weight
+	}
+	subsets = append(subsets, rest)
+
+	for _, e := range entries {
+		s := rest
+		for index, split := range splits {
+			if split.Selects(e.Labels) {
+				s = subsets[index]
+				break
+			}
+		}
+		s.add(backends[e.ProxyIp])
+	}
+
+	//empty subsets give their share to the others
+	for _, s := range subsets {
+		if len(s.Backends) > 0 && s.Weight > 0 {
+			s.Balancer = NewBalancer(t.Balance)
+			t.subsets = append(t.subsets, s)
+		}
+	}
+}
+
+//add backend once
+func (s *subset) add(backend *Backend) {
+	for _, b := range s.Backends {
+		if b == backend {
+			return
+		}
+	}
+	s.Backends = append(s.Backends, backend)
+}
+
+//pick subset by weight, the same hash key always picks the same subset
+func (t *Target) subset(key string) *subset {
+	var total int64
+	for _, s := range t.subsets {
+		total += s.Weight
+	}
+
+	var n int64
+	if len(key) > 0 {
+		n = int64(hash(key) % uint64(total))
+	} else {
+		n = rand.Int63n(total)
+	}
+	for _, s := range t.subsets {
+		if n < s.Weight {
+			return s
+		}
+		n -= s.Weight
+	}
+	return t.subsets[len(t.subsets)-1]
+}
@@ -0,0 +1,80 @@
+package route
+
+import (
+	"fmt"
+	"net/url"
+
+	"sigs.k8s.io/yaml"
+)
+
+type (
+	//static rule, routed to fixed backend urls instead of pods or services
+	StaticRule struct {
+		Rule
+		//backend urls (http://10.0.0.1:8080, https://docs.example.com),
+		//a path of the url is put before the proxy path
+		Backends []string `json:"backends"`
+	}
+
+	//static rules
+	StaticRules struct {
+		Items []*StaticRule `json:"items"`
+	}
+)
+
+//parse plain json or yaml static rules, unknown fields are rejected and
+//every rule is validated
+func ParseStatic(data []byte) (*StaticRules, error) {
+	r := new(StaticRules)
+	if err := yaml.UnmarshalStrict(data, r); err != nil {
+		return nil, err
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//check static rules
+func (r *StaticRules) Validate() error {
+	if len(r.Items) <= 0 {
+		return fmt.Errorf("rules is empty")
+	}
+	for index, rule := range r.Items {
+		if rule == nil {
+			return fmt.Errorf("rule %d is empty", index)
+		}
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//check backend urls and rule, the port is not used
+func (r *StaticRule) Validate() error {
+	if len(r.Backends) <= 0 {
+		return fmt.Errorf("rule %s backends is empty", r.AgentUrl)
+	}
+	for _, backend := range r.Backends {
+		u, err := url.Parse(backend)
+		if err != nil {
+			return fmt.Errorf("rule %s backend %s", r.AgentUrl, err.Error())
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) <= 0 || len(u.RawQuery) > 0 {
+			return fmt.Errorf("rule %s backend %s should be http(s)://host[:port][/path]", r.AgentUrl, backend)
+		}
+	}
+	return r.Rule.validateUrls()
+}
+
+//registrations of static rules
+func (r *StaticRules) Registrations() []*Registration {
+	var registrations []*Registration
+	for _, rule := range r.Items {
+		for _, backend := range rule.Backends {
+			registrations = append(registrations, NewRegistration(&rule.Rule, backend, nil))
+		}
+	}
+	return registrations
+}
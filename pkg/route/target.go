@@ -0,0 +1,258 @@
+package route
+
+import (
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type (
+	//proxy target, backend pool behind one matched rule
+	Target struct {
+		Predicate
+		Key      string
+		ProxyUrl string
+		//param segments of agent url (:roomId, *path)
+		Params   []string
+		Backends []*Backend
+		//backends of terminating pods, they keep the requests of their
+		//hash keys and take others only when no backend is left
+		Draining []*Backend
+		Balance  Balance
+		HashKey  *HashKey
+		Rewrite  *Rewrite
+		Balancer Balancer
+		//weighted splits of backends, empty without split
+		subsets []*subset
+		//shadow backends receiving copies of requests
+		Mirror  *Mirror
+		Mirrors []*Backend
+		mirrors Balancer
+		//ring of backends and draining backends
+		drains Balancer
+	}
+
+	//targets sharing one agent url, most conditions first
+	Targets []*Target
+
+	//captured path params
+	Params map[string]string
+)
+
+//new target
+func NewTarget(predicate Predicate) *Target {
+	return &Target{
+		Predicate: predicate,
+		Key:       predicate.Key(),
+	}
+}
+
+//find target by predicate key
+func (t Targets) Find(key string) (*Target, bool) {
+	for _, target := range t {
+		if target.Key == key {
+			return target, true
+		}
+	}
+	return nil, false
+}
+
+//add target keeping most conditions first
+func (t Targets) Add(target *Target) Targets {
+	t = append(t, target)
+	sort.SliceStable(t, func(i, j int) bool {
+		if t[i].Len() != t[j].Len() {
+			return t[i].Len() > t[j].Len()
+		}
+		return t[i].Key < t[j].Key
+	})
+	return t
+}
+
+//copy targets replacing the target with key, nil target removes it
+func (t Targets) Replace(key string, target *Target) Targets {
+	next := make(Targets, 0, len(t)+1)
+	for _, o := range t {
+		if o.Key != key {
+			next = append(next, o)
+		}
+	}
+	if target != nil {
+		next = next.Add(target)
+	}
+	return next
+}
+
+//first target with backends matching request
+func (t Targets) Match(r *http.Request) *Target {
+	for _, target := range t {
+		if len(target.Backends)+len(target.Draining) > 0 && target.Predicate.Match(r) {
+			return target
+		}
+	}
+	return nil
+}
+
+//set proxy url, rewrite and balancer from rule
+func (t *Target) Set(rule *Rule) {
+	t.ProxyUrl = rule.ProxyUrl
+	t.HashKey = rule.HashKey
+	t.Rewrite = rule.Rewrite
+	if t.Balancer == nil || t.Balance != rule.Balance {
+		t.Balance = rule.Balance
+		t.Balancer = NewBalancer(rule.Balance)
+	}
+}
+
+//add backend to pool
+func (t *Target) AddBackend(backend *Backend) {
+	for _, b := range t.Backends {
+		if b.ProxyIp == backend.ProxyIp {
+			return
+		}
+	}
+	t.Backends = append(t.Backends, backend)
+}
+
+//add draining backend to pool, a backend also added live is not draining
+func (t *Target) AddDraining(backend *Backend) {
+	for _, b := range t.Backends {
+		if b.ProxyIp == backend.ProxyIp {
+			return
+		}
+	}
+	for _, b := range t.Draining {
+		if b.ProxyIp == backend.ProxyIp {
+			return
+		}
+	}
+	t.Draining = append(t.Draining, backend)
+	if t.drains == nil {
+		t.drains = new(consistentHash)
+	}
+}
+
+//pick backend for request
+func (t *Target) Pick(r *http.Request, params Params) *Backend {
+	if t.Balancer == nil {
+		return nil
+	}
+	var key string
+	if t.HashKey != nil {
+		key = t.HashKey.Value(r, params)
+	}
+
+	//a hash key of a draining backend stays on it, ring points only
+	//depend on the backend so the other keys map as without it
+	if len(key) > 0 && len(t.Draining) > 0 && t.Balance == ConsistentHash {
+		all := make([]*Backend, 0, len(t.Backends)+len(t.Draining))
+		all = append(append(all, t.Backends...), t.Draining...)
+		if backend := t.drains.Pick(all, key); t.draining(backend) {
+			return backend
+		}
+	}
+
+	var backend *Backend
+	if len(t.subsets) > 0 {
+		s := t.subset(key)
+		backend = s.Balancer.Pick(s.Backends, key)
+	} else {
+		backend = t.Balancer.Pick(t.Backends, key)
+	}
+	if backend == nil && len(t.Draining) > 0 {
+		return t.Draining[rand.Intn(len(t.Draining))]
+	}
+	return backend
+}
+
+//backend is draining
+func (t *Target) draining(backend *Backend) bool {
+	for _, b := range t.Draining {
+		if b == backend {
+			return true
+		}
+	}
+	return false
+}
+
+//pick backend and mirror, build proxy url
+func (t *Target) result(r *http.Request, rest []string, params, raw Params) (*Result, bool) {
+	backend := t.Pick(r, params)
+	if backend == nil {
+		return nil, false
+	}
+	result := &Result{
+		Backend: backend,
+		Mirror:  t.pickMirror(),
+	}
+	if t.Rewrite != nil {
+		result.Path, result.RawQuery = t.Rewrite.rewrite(r, params, raw)
+		result.Host = t.Rewrite.Host
+	} else {
+		result.Path, result.RawQuery = t.proxyUrl(rest, params, raw)
+		if len(r.URL.RawQuery) > 0 {
+			if len(result.RawQuery) > 0 {
+				result.RawQuery += "&" + r.URL.RawQuery
+			} else {
+				result.RawQuery = r.URL.RawQuery
+			}
+		}
+	}
+	return result, true
+}
+
+//build proxy url, the unmatched escaped rest is appended to the proxy
+//path and {name} is replaced by the captured params
+func (t *Target) proxyUrl(rest []string, params, raw Params) (string, string) {
+	path, query := t.ProxyUrl, ""
+	if index := strings.Index(path, "?"); index >= 0 {
+		path, query = path[:index], path[index+1:]
+	}
+
+	//append rest
+	if len(rest) > 0 {
+		path = strings.TrimSuffix(path, "/") + "/" + strings.Join(rest, "/")
+	}
+
+	//replace params
+	if len(params) > 0 {
+		path = expand(path, raw, false)
+		query = expand(query, params, true)
+	}
+	return path, query
+}
+
+//replace {name} with params, unknown names are kept
+func expand(template string, params Params, escape bool) string {
+	if !strings.Contains(template, "{") {
+		return template
+	}
+
+	var builder strings.Builder
+	for {
+		start := strings.Index(template, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(template[start:], "}")
+		if end < 0 {
+			break
+		}
+		end += start
+
+		builder.WriteString(template[:start])
+		if value, ok := params[template[start+1:end]]; ok {
+			if escape {
+				value = url.QueryEscape(value)
+			}
+			builder.WriteString(value)
+		} else {
+			builder.WriteString(template[start : end+1])
+		}
+		template = template[end+1:]
+	}
+	builder.WriteString(template)
+	return builder.String()
+}